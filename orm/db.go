@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -37,9 +38,34 @@ var (
 		"between":     true,
 		"isnull":      true,
 		"regex":       true,
+		"iregex":      true,
+		// mongodb only
+		"all":       true,
+		"elemmatch": true,
+		"size":      true,
+		"exists":    true,
+		"type":      true,
+		"mod":       true,
+		"expr":      true,
+		"text":      true,
+		"where":     true,
+	}
+	mongoOnlyOperators = map[string]bool{
+		"all":       true,
+		"elemmatch": true,
+		"size":      true,
+		"exists":    true,
+		"type":      true,
+		"mod":       true,
+		"expr":      true,
+		"text":      true,
+		"where":     true,
 	}
 )
 
+// escape the wildcards of LIKE.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 type dbBase struct {
 	ins dbBaser
 }
@@ -88,12 +114,13 @@ func (d *dbBase) GenerateOperatorSQL(mi *modelInfo, fi *fieldInfo, operator stri
 		}
 		sql = d.ins.OperatorSQL(operator)
 		switch operator {
-		case "exact":
+		case "exact", "eq":
 			if arg == nil {
-				params[0] = "IS NULL"
+				sql = "IS NULL"
+				params = nil
 			}
 		case "iexact", "contains", "icontains", "startswith", "endswith", "istartswith", "iendswith":
-			param := strings.Replace(ToStr(arg), `%`, `\%`, -1)
+			param := likeEscaper.Replace(ToStr(arg))
 			switch operator {
 			case "iexact":
 			case "contains", "icontains":
@@ -702,7 +729,7 @@ setValue:
 	return value, nil
 }
 
-func (d *dbBase) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, exprs []string, container interface{}, tz *time.Location) (cnt int64, err error) {
+func (d *dbBase) ReadValues(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, exprs []string, container interface{}, tz *time.Location) (cnt int64, err error) {
 	return
 }
 
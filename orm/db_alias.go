@@ -20,11 +20,16 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/souliot/siot-orm/pool"
 
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 )
 
@@ -111,53 +116,130 @@ type DB struct {
 	DB      *sql.DB
 	TX      interface{}
 	isTx    bool
+	txCtx   context.Context
 	stmts   map[string]*sql.Stmt
+	lease   *pool.Lease
+	alias   *alias
+	// write concern of the Ormer, mongodb only.
+	writeConcern *writeconcern.WriteConcern
+	// how the clickhouse Update of the Ormer waits for its mutation.
+	mutationWait MutationWait
 }
 
 var _ dbQuerier = new(DB)
 
 func (d *DB) Begin() (err error) {
-	d.isTx = true
+	return d.BeginTx(todo)
+}
+
+// begin a transaction, ctx is kept to commit or rollback it.
+func (d *DB) BeginTx(ctx context.Context) (err error) {
 	switch d.DbType {
 	case DRMongo:
 		d.Session, err = d.MDB.Client().StartSession()
 		if err != nil {
 			return
 		}
-		defer d.Session.EndSession(todo)
 
-		//开始事务
-		err = d.Session.StartTransaction()
+		//开始事务，写关注只能设置在事务上
+		topts := options.Transaction()
+		if d.writeConcern != nil {
+			topts.SetWriteConcern(d.writeConcern)
+		}
+		err = d.Session.StartTransaction(topts)
+		if err != nil {
+			d.endSession()
+			return
+		}
 	case DRClickHouse:
-		d.TX, err = d.DB.Begin()
+		d.TX, err = d.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return
+		}
 	default:
 	}
-
+	d.isTx = true
+	d.txCtx = ctx
 	return
 }
 
 func (d *DB) Commit() (err error) {
+	if !d.isTx {
+		return ErrTxDone
+	}
 	d.isTx = false
 	switch d.DbType {
 	case DRMongo:
-		return d.Session.CommitTransaction(todo)
+		err = newTxError(d.Session.CommitTransaction(d.txCtx))
+		d.endSession()
 	case DRClickHouse:
-		return d.TX.(*sql.Tx).Commit()
+		err = d.TX.(*sql.Tx).Commit()
+		d.closeStmts()
 	default:
 	}
 	return
 }
+
 func (d *DB) Rollback() (err error) {
+	if !d.isTx {
+		return ErrTxDone
+	}
 	d.isTx = false
 	switch d.DbType {
 	case DRMongo:
-		return d.Session.AbortTransaction(todo)
+		err = d.Session.AbortTransaction(d.txCtx)
+		d.endSession()
 	case DRClickHouse:
-		return d.TX.(*sql.Tx).Rollback()
+		err = d.TX.(*sql.Tx).Rollback()
+		d.closeStmts()
 	default:
 	}
 	return
 }
+
+// end the mongo session, an uncommitted transaction is aborted by the server.
+func (d *DB) endSession() {
+	if d.Session != nil {
+		d.Session.EndSession(todo)
+		d.Session = nil
+	}
+}
+
+// statements prepared on a transaction can not be used after it finished.
+func (d *DB) closeStmts() {
+	d.Lock()
+	for query, stmt := range d.stmts {
+		stmt.Close()
+		delete(d.stmts, query)
+	}
+	d.Unlock()
+}
+
+// give the connection back to the pool, the DB must not be used after that.
+func (d *DB) release() {
+	d.closeStmts()
+	if d.lease != nil {
+		d.lease.Release()
+		d.lease = nil
+	}
+}
+
+// bind ctx to the running mongo session, so that operations join the transaction.
+func (d *DB) sessionContext(ctx context.Context) context.Context {
+	if d.isTx && d.Session != nil {
+		return mongo.NewSessionContext(ctx, d.Session)
+	}
+	return ctx
+}
+
+// wrap errors raised inside a running transaction, so that callers can match them.
+func (d *DB) txError(err error) error {
+	if !d.isTx {
+		return err
+	}
+	return newTxError(err)
+}
+
 func (d *DB) getStmt(query string) (*sql.Stmt, error) {
 	d.RLock()
 	if stmt, ok := d.stmts[query]; ok {
@@ -196,96 +278,157 @@ func (d *DB) Prepare(query string) (st *sql.Stmt, err error) {
 }
 
 func (d *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if d.isTx {
+		return d.TX.(*sql.Tx).PrepareContext(ctx, query)
+	}
 	return d.DB.PrepareContext(ctx, query)
 }
 
 func (d *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	stmt, err := d.getStmt(query)
-	if err != nil {
-		return nil, err
-	}
-	return stmt.Exec(args...)
+	return d.ExecContext(todo, query, args...)
 }
 
-func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+func (d *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	a := time.Now()
 	stmt, err := d.getStmt(query)
-	if err != nil {
-		return nil, err
+	if err == nil {
+		res, err = stmt.ExecContext(ctx, args...)
 	}
-	return stmt.ExecContext(ctx, args...)
+	d.logQuery("db.Exec", query, a, err, args...)
+	return
 }
 
 func (d *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	stmt, err := d.getStmt(query)
-	if err != nil {
-		return nil, err
-	}
-	return stmt.Query(args...)
+	return d.QueryContext(todo, query, args...)
 }
 
-func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+func (d *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	a := time.Now()
 	stmt, err := d.getStmt(query)
-	if err != nil {
-		return nil, err
+	if err == nil {
+		rows, err = stmt.QueryContext(ctx, args...)
 	}
-	return stmt.QueryContext(ctx, args...)
+	d.logQuery("db.Query", query, a, err, args...)
+	return
 }
 
 func (d *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return d.QueryRowContext(todo, query, args...)
+}
+
+func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	a := time.Now()
 	stmt, err := d.getStmt(query)
+	d.logQuery("db.QueryRow", query, a, err, args...)
 	if err != nil {
 		panic(err)
 	}
-	return stmt.QueryRow(args...)
+	return stmt.QueryRowContext(ctx, args...)
+}
 
+// log the clickhouse query when Debug or the Debug of the alias is set.
+func (d *DB) logQuery(operation, query string, t time.Time, err error, args ...interface{}) {
+	if d.alias != nil && (Debug || d.alias.Debug) {
+		debugLogQueies(d.alias, operation, query, t, err, args...)
+	}
 }
 
-func (d *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+type alias struct {
+	Name           string
+	Driver         DriverType
+	DriverName     string
+	DataSource     string
+	DbName         string
+	MaxIdleConns   int
+	MaxOpenConns   int
+	DbBaser        dbBaser
+	TZ             *time.Location
+	Engine         string
+	NameStrategy   string
+	ReadPreference *readpref.ReadPref
+	ReadConcern    *readconcern.ReadConcern
+	WriteConcern   *writeconcern.WriteConcern
+	QueryTimeout   time.Duration
+	Debug          bool
+	Replicas       []string
+	ReplicaPolicy  ReplicaPolicy
+	replicaNext    uint32
+	// read preference of the mongodb replica pools by pool name.
+	replicaReadPrefs map[string]*readpref.ReadPref
+}
 
-	stmt, err := d.getStmt(query)
-	if err != nil {
-		panic(err)
+// ReplicaPolicy how to choose a replica for a read.
+type ReplicaPolicy int
+
+const (
+	// ReplicaRoundRobin choose the replicas in turn.
+	ReplicaRoundRobin ReplicaPolicy = iota
+	// ReplicaLeastLoaded choose the replica with the fewest connections in use.
+	ReplicaLeastLoaded
+)
+
+// get the pool name of the i-th replica of an alias.
+func replicaPoolName(aliasName string, i int) string {
+	return fmt.Sprintf("%s#replica%d", aliasName, i)
+}
+
+// choose the pool name of a replica to read from.
+func (al *alias) replica() string {
+	if al.ReplicaPolicy == ReplicaLeastLoaded {
+		name, inUse := al.Replicas[0], -1
+		for _, r := range al.Replicas {
+			stats, _ := pool.Stats(r)
+			if inUse < 0 || stats.InUse < inUse {
+				name, inUse = r, stats.InUse
+			}
+		}
+		return name
 	}
-	return stmt.QueryRowContext(ctx, args)
+	i := atomic.AddUint32(&al.replicaNext, 1)
+	return al.Replicas[int(i-1)%len(al.Replicas)]
 }
 
-type alias struct {
-	Name         string
-	Driver       DriverType
-	DriverName   string
-	DataSource   string
-	DbName       string
-	MaxIdleConns int
-	MaxOpenConns int
-	DB           *DB
-	DbBaser      dbBaser
-	TZ           *time.Location
-	Engine       string
-}
-
-func (al *alias) getDB() (db *DB, err error) {
-	if al.Name == "" {
-		al.Name = "default"
-	}
-	client, err := pool.GetClient(al.Name)
+// lease a connection from the pool named poolName, the primary or a replica of alias,
+// the DB holds it until release.
+func (al *alias) getDB(ctx context.Context, poolName string) (db *DB, err error) {
+	if poolName == "" {
+		poolName = "default"
+	}
+	lease, err := pool.Acquire(ctx, poolName)
 	if err != nil {
 		DebugLog.Println(err.Error())
 		return
 	}
 
 	if al.Driver == DRMongo {
+		opts := options.Database()
+		if rp, ok := al.replicaReadPrefs[poolName]; ok {
+			opts.SetReadPreference(rp)
+		} else if al.ReadPreference != nil {
+			opts.SetReadPreference(al.ReadPreference)
+		}
+		if al.ReadConcern != nil {
+			opts.SetReadConcern(al.ReadConcern)
+		}
+		if al.WriteConcern != nil {
+			opts.SetWriteConcern(al.WriteConcern)
+		}
 		db = &DB{
 			DbType:  DRMongo,
-			MDB:     client.(*mongo.Client).Database(al.DbName),
+			MDB:     lease.Client().(*mongo.Client).Database(al.DbName, opts),
 			Session: nil,
 			RWMutex: new(sync.RWMutex),
+			lease:   lease,
+			alias:   al,
 		}
 	} else {
 		db = &DB{
 			DbType:  DRClickHouse,
-			DB:      client.(*sql.DB),
+			DB:      lease.Client().(*sql.DB),
 			stmts:   make(map[string]*sql.Stmt),
 			RWMutex: new(sync.RWMutex),
+			lease:   lease,
+			alias:   al,
 		}
 	}
 	return
@@ -323,25 +466,77 @@ func AddAlias(aliasName, driverName string) error {
 }
 
 // RegisterDataBase Setting the database connect params. Use the database driver self dataSource args.
+// params are the initial size, the capacity, the idle timeout and the wait timeout of the pool,
+// the timeouts are in seconds. use RegisterDataBaseWithOptions for other settings.
 func RegisterDataBase(aliasName, driverName, dataSource string, force bool, params ...int) (err error) {
+	opts := NewDataBaseOptions()
+	for i, v := range params {
+		switch i {
+		case 0:
+			opts.InitialCap = v
+		case 1:
+			opts.MaxCap = v
+		case 2:
+			opts.IdleTimeout = time.Duration(v) * time.Second
+		case 3:
+			opts.WaitTimeout = time.Duration(v) * time.Second
+		}
+	}
+	return RegisterDataBaseWithOptions(aliasName, driverName, dataSource, force, opts)
+}
+
+// RegisterDataBaseWithOptions Setting the database connect params and the options of the alias,
+// start from NewDataBaseOptions to keep the defaults.
+func RegisterDataBaseWithOptions(aliasName, driverName, dataSource string, force bool, opts DataBaseOptions) (err error) {
 	var (
 		al *alias
 	)
-	if t, ok := drivers[driverName]; ok {
-		switch t {
+	if opts.NameStrategy != "" {
+		if _, ok := nameStrategyMap[opts.NameStrategy]; !ok {
+			err = fmt.Errorf("name strategy `%s` not exists", opts.NameStrategy)
+			DebugLog.Println(err.Error())
+			return
+		}
+	}
+	register := func(poolName, dataSource string) error {
+		switch drivers[driverName] {
 		case DRMongo:
-			err = pool.RegisterMgoPool(aliasName, dataSource, force, params...)
+			conn := &pool.MgoConn{Address: dataSource, Monitor: newCommandMonitor(aliasName)}
+			return pool.RegisterPoolWithConfig(poolName, conn, force, opts.poolConfig())
 		case DRClickHouse:
-			err = pool.RegisterClickPool(aliasName, dataSource, force, params...)
+			return pool.RegisterClickPoolWithConfig(poolName, dataSource, force, opts.poolConfig())
 		default:
-			err = ErrNoDriver
+			return ErrNoDriver
 		}
 	}
+	if _, ok := drivers[driverName]; ok {
+		err = register(aliasName, dataSource)
+	}
 	if err != nil {
 		DebugLog.Println(err.Error())
 		return
 	}
 
+	replicas := make([]string, 0, len(opts.Replicas))
+	replicaReadPrefs := make(map[string]*readpref.ReadPref)
+	for i, replica := range opts.Replicas {
+		name := replicaPoolName(aliasName, i)
+		if err = register(name, replica); err != nil {
+			DebugLog.Println(err.Error())
+			pool.ReleasePool(aliasName)
+			for _, r := range replicas {
+				pool.ReleasePool(r)
+			}
+			return
+		}
+		replicas = append(replicas, name)
+		if drivers[driverName] == DRMongo {
+			if rp := replicaReadPref(opts, replica); rp != nil {
+				replicaReadPrefs[name] = rp
+			}
+		}
+	}
+
 	al, err = addAlias(aliasName, driverName, force)
 	if err != nil {
 		DebugLog.Println(err.Error())
@@ -350,12 +545,32 @@ func RegisterDataBase(aliasName, driverName, dataSource string, force bool, para
 
 	al.DataSource = dataSource
 	al.DbName = getDatabase(al.DataSource)
+	al.Replicas = replicas
+	al.replicaReadPrefs = replicaReadPrefs
+	al.ReplicaPolicy = opts.ReplicaPolicy
 
 	detectTZ(al)
+	if opts.TZ != nil {
+		al.TZ = opts.TZ
+	}
+	al.NameStrategy = opts.NameStrategy
+	al.ReadPreference = opts.ReadPreference
+	al.ReadConcern = opts.ReadConcern
+	al.WriteConcern = opts.WriteConcern
+	al.QueryTimeout = opts.QueryTimeout
+	al.Debug = opts.Debug
 
 	return
 }
 
+// get the name strategy of raw query columns.
+func (al *alias) nameStrategy() string {
+	if al.NameStrategy != "" {
+		return al.NameStrategy
+	}
+	return nameStrategy
+}
+
 func HasDefaultDataBase() bool {
 	if dataBaseCache.getDefault() == nil {
 		return false
@@ -364,10 +579,51 @@ func HasDefaultDataBase() bool {
 }
 
 func ReleaseDataBase(aliasName string) {
+	if al, ok := dataBaseCache.get(aliasName); ok {
+		for _, r := range al.Replicas {
+			pool.ReleasePool(r)
+		}
+	}
 	dataBaseCache.del(aliasName)
 	pool.ReleasePool(aliasName)
 }
 
+// DataBaseStats statistics of the pool of a database alias.
+type DataBaseStats struct {
+	pool.PoolStats
+	// sum of sql.DB.Stats() of every clickhouse connection in the pool, empty for mongodb.
+	SQL sql.DBStats
+}
+
+// DBStats get the statistics of the pool of a database alias, ClickHouse aliases also
+// include the statistics of database/sql.
+func DBStats(aliasName string) (stats DataBaseStats, err error) {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return stats, fmt.Errorf("DataBase alias name `%s` not registered", aliasName)
+	}
+	stats.PoolStats, ok = pool.Stats(aliasName)
+	if !ok {
+		return stats, pool.ErrGetConnection
+	}
+	if al.Driver != DRClickHouse {
+		return
+	}
+	for _, conn := range pool.Conns(aliasName) {
+		s := conn.(*sql.DB).Stats()
+		stats.SQL.MaxOpenConnections += s.MaxOpenConnections
+		stats.SQL.OpenConnections += s.OpenConnections
+		stats.SQL.InUse += s.InUse
+		stats.SQL.Idle += s.Idle
+		stats.SQL.WaitCount += s.WaitCount
+		stats.SQL.WaitDuration += s.WaitDuration
+		stats.SQL.MaxIdleClosed += s.MaxIdleClosed
+		stats.SQL.MaxIdleTimeClosed += s.MaxIdleTimeClosed
+		stats.SQL.MaxLifetimeClosed += s.MaxLifetimeClosed
+	}
+	return
+}
+
 // RegisterDriver Register a database driver use specify driver name, this can be definition the driver is which database type.
 func RegisterDriver(driverName string, typ DriverType) error {
 	if t, ok := drivers[driverName]; !ok {
@@ -390,6 +646,18 @@ func SetDataBaseTZ(aliasName string, tz *time.Location) error {
 	return nil
 }
 
+// get the read preference of a mongodb replica, the reads of a replica set uri go to its primary
+// unless the options or the uri set a read preference, so secondaryPreferred is used then.
+func replicaReadPref(opts DataBaseOptions, uri string) *readpref.ReadPref {
+	if opts.ReadPreference != nil {
+		return nil
+	}
+	if cs, err := connstring.Parse(uri); err == nil && cs.ReadPreference != "" {
+		return nil
+	}
+	return readpref.SecondaryPreferred()
+}
+
 func getDatabase(uri string) (dbName string) {
 	cs, err := connstring.Parse(uri)
 	if err != nil {
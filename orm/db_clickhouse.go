@@ -1,33 +1,57 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 var (
 	OpDefault OperatorUpdate = "$set"
+
+	ErrKeyColumn = errors.New("<Ormer.Update> can not update the key column of clickhouse")
+	// interval of polling system.mutations for MutationPoll.
+	MutationPollInterval = 100 * time.Millisecond
+)
+
+// MutationWait define how Update waits for the clickhouse mutation it created.
+type MutationWait int
+
+const (
+	// return once the mutation is created.
+	MutationAsync MutationWait = iota
+	// wait for the mutation on the current server by mutations_sync = 1.
+	MutationSync
+	// wait for the mutation on all replicas by mutations_sync = 2.
+	MutationSyncAll
+	// poll system.mutations until the mutation is done or failed.
+	MutationPoll
 )
+
 var clickOperators = map[string]string{
-	"exact":     "= ?",
-	"iexact":    "LIKE ?",
-	"contains":  "LIKE BINARY ?",
-	"icontains": "LIKE ?",
-	// "regex":       "REGEXP BINARY ?",
-	// "iregex":      "REGEXP ?",
+	"exact":       "= ?",
+	"iexact":      "ILIKE ?",
+	"contains":    "LIKE ?",
+	"icontains":   "ILIKE ?",
+	"regex":       "= 1",
+	"iregex":      "= 1",
 	"gt":          "> ?",
 	"gte":         ">= ?",
 	"lt":          "< ?",
 	"lte":         "<= ?",
 	"eq":          "= ?",
 	"ne":          "!= ?",
-	"startswith":  "LIKE BINARY ?",
-	"endswith":    "LIKE BINARY ?",
-	"istartswith": "LIKE ?",
-	"iendswith":   "LIKE ?",
+	"nq":          "!= ?",
+	"startswith":  "LIKE ?",
+	"endswith":    "LIKE ?",
+	"istartswith": "ILIKE ?",
+	"iendswith":   "ILIKE ?",
 }
 
 // mysql dbBaser implementation.
@@ -49,10 +73,20 @@ func (d *dbBaseClickHouse) OperatorSQL(operator string) string {
 	return clickOperators[operator]
 }
 
+// regex lookups use match(), the pattern is the only param.
+func (d *dbBaseClickHouse) GenerateOperatorLeftCol(fi *fieldInfo, operator string, leftCol *string) {
+	switch operator {
+	case "regex":
+		*leftCol = fmt.Sprintf("match(%s, ?)", *leftCol)
+	case "iregex":
+		*leftCol = fmt.Sprintf("match(%s, concat('(?i)', ?))", *leftCol)
+	}
+}
+
 // read one record.
-func (d *dbBaseClickHouse) FindOne(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, container interface{}, tz *time.Location, cols []string) (err error) {
+func (d *dbBaseClickHouse) FindOne(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, container interface{}, tz *time.Location, cols []string) (err error) {
 	qs.limit = 1
-	err = d.ReadBatch(q, qs, mi, cond, container, tz, cols)
+	err = d.ReadBatch(ctx, q, qs, mi, cond, container, tz, cols)
 	if err != nil {
 		return err
 	}
@@ -60,13 +94,24 @@ func (d *dbBaseClickHouse) FindOne(q dbQuerier, qs *querySet, mi *modelInfo, con
 	return nil
 }
 
-// read one record.
-func (d *dbBaseClickHouse) Distinct(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, field string) (res []interface{}, err error) {
-	return
+// read the distinct values of field, orders, limit and offset are ignored like mongodb.
+func (d *dbBaseClickHouse) Distinct(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, field string) (res []interface{}, err error) {
+	dqs := *qs
+	dqs.distinct = true
+	dqs.groups = nil
+	dqs.orders = nil
+	dqs.limit = 0
+	dqs.offset = 0
+
+	var list ParamsList
+	if _, err = d.ReadValues(ctx, q, &dqs, mi, cond, []string{field}, &list, tz); err != nil {
+		return nil, err
+	}
+	return list, nil
 }
 
 // read all records.
-func (d *dbBaseClickHouse) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, container interface{}, tz *time.Location, cols []string) (err error) {
+func (d *dbBaseClickHouse) ReadBatch(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, container interface{}, tz *time.Location, cols []string) (err error) {
 	val := reflect.ValueOf(container)
 	ind := reflect.Indirect(val)
 
@@ -100,6 +145,90 @@ func (d *dbBaseClickHouse) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, c
 		}
 	}
 
+	sel, err := d.selectQuery(qs, mi, cond, tz, cols)
+	if err != nil {
+		return err
+	}
+
+	rs, err := q.QueryContext(ctx, sel.query, sel.args...)
+	if err != nil {
+		return err
+	}
+
+	refs := sel.newRefs()
+
+	defer rs.Close()
+
+	slice := ind
+
+	var cnt int64
+	for rs.Next() {
+		if one && cnt == 0 || !one {
+			if err := rs.Scan(refs...); err != nil {
+				return err
+			}
+
+			mind := d.scanModel(sel, mi, refs, tz)
+
+			if one {
+				ind.Set(mind)
+			} else {
+				if cnt == 0 {
+					// you can use a empty & caped container list
+					// orm will not replace it
+					if ind.Len() != 0 {
+						// if container is not empty
+						// create a new one
+						slice = reflect.New(ind.Type()).Elem()
+					}
+				}
+
+				if isPtr {
+					slice = reflect.Append(slice, mind.Addr())
+				} else {
+					slice = reflect.Append(slice, mind)
+				}
+			}
+		}
+		cnt++
+	}
+
+	if !one {
+		if cnt > 0 {
+			ind.Set(slice)
+		} else {
+			// when a result is empty and container is nil
+			// to set a empty container
+			if ind.IsNil() {
+				ind.Set(reflect.MakeSlice(ind.Type(), 0, 0))
+			}
+		}
+	}
+
+	return nil
+}
+
+// select query of the records, with the columns of the model and the related tables.
+type selectQuery struct {
+	query   string
+	args    []interface{}
+	tCols   []string
+	tables  *dbTables
+	colsNum int
+}
+
+// create the scan destinations of a row.
+func (s *selectQuery) newRefs() []interface{} {
+	refs := make([]interface{}, s.colsNum)
+	for i := range refs {
+		var ref interface{}
+		refs[i] = &ref
+	}
+	return refs
+}
+
+// build the select query of ReadBatch and ReadRows.
+func (d *dbBaseClickHouse) selectQuery(qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, cols []string) (*selectQuery, error) {
 	rlimit := qs.limit
 	offset := qs.offset
 
@@ -120,7 +249,7 @@ func (d *dbBaseClickHouse) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, c
 					maps[fi.column] = true
 				}
 			} else {
-				return fmt.Errorf("wrong field/column name `%s`", col)
+				return nil, fmt.Errorf("wrong field/column name `%s`", col)
 			}
 		}
 		if hasRel {
@@ -169,128 +298,121 @@ func (d *dbBaseClickHouse) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, c
 
 	d.ins.ReplaceMarks(&query)
 
-	var rs *sql.Rows
-	if qs != nil && qs.forContext {
-		rs, err = q.QueryContext(qs.ctx, query, args...)
-		if err != nil {
-			return err
-		}
-	} else {
-		rs, err = q.Query(query, args...)
-		if err != nil {
-			return err
-		}
-	}
-
-	refs := make([]interface{}, colsNum)
-	for i := range refs {
-		var ref interface{}
-		refs[i] = &ref
-	}
+	return &selectQuery{
+		query:   query,
+		args:    args,
+		tCols:   tCols,
+		tables:  tables,
+		colsNum: colsNum,
+	}, nil
+}
 
-	defer rs.Close()
+// set the scanned refs of a row to a new model and its related models.
+func (d *dbBaseClickHouse) scanModel(sel *selectQuery, mi *modelInfo, refs []interface{}, tz *time.Location) reflect.Value {
+	elm := reflect.New(mi.addrField.Elem().Type())
+	mind := reflect.Indirect(elm)
 
-	slice := ind
+	cacheV := make(map[string]*reflect.Value)
+	cacheM := make(map[string]*modelInfo)
+	trefs := refs
 
-	var cnt int64
-	for rs.Next() {
-		if one && cnt == 0 || !one {
-			if err := rs.Scan(refs...); err != nil {
-				return err
-			}
+	d.setColsValues(mi, &mind, sel.tCols, refs[:len(sel.tCols)], tz)
+	trefs = refs[len(sel.tCols):]
 
-			elm := reflect.New(mi.addrField.Elem().Type())
-			mind := reflect.Indirect(elm)
-
-			cacheV := make(map[string]*reflect.Value)
-			cacheM := make(map[string]*modelInfo)
-			trefs := refs
-
-			d.setColsValues(mi, &mind, tCols, refs[:len(tCols)], tz)
-			trefs = refs[len(tCols):]
-
-			for _, tbl := range tables.tables {
-				// loop selected tables
-				if tbl.sel {
-					last := mind
-					names := ""
-					mmi := mi
-					// loop cascade models
-					for _, name := range tbl.names {
-						names += name
-						if val, ok := cacheV[names]; ok {
-							last = *val
-							mmi = cacheM[names]
-						} else {
-							fi := mmi.fields.GetByName(name)
-							lastm := mmi
-							mmi = fi.relModelInfo
-							field := last
-							if last.Kind() != reflect.Invalid {
-								field = reflect.Indirect(last.FieldByIndex(fi.fieldIndex))
-								if field.IsValid() {
-									d.setColsValues(mmi, &field, mmi.fields.dbcols, trefs[:len(mmi.fields.dbcols)], tz)
-									for _, fi := range mmi.fields.fieldsReverse {
-										if fi.inModel && fi.reverseFieldInfo.mi == lastm {
-											if fi.reverseFieldInfo != nil {
-												f := field.FieldByIndex(fi.fieldIndex)
-												if f.Kind() == reflect.Ptr {
-													f.Set(last.Addr())
-												}
-											}
+	for _, tbl := range sel.tables.tables {
+		// loop selected tables
+		if tbl.sel {
+			last := mind
+			names := ""
+			mmi := mi
+			// loop cascade models
+			for _, name := range tbl.names {
+				names += name
+				if val, ok := cacheV[names]; ok {
+					last = *val
+					mmi = cacheM[names]
+				} else {
+					fi := mmi.fields.GetByName(name)
+					lastm := mmi
+					mmi = fi.relModelInfo
+					field := last
+					if last.Kind() != reflect.Invalid {
+						field = reflect.Indirect(last.FieldByIndex(fi.fieldIndex))
+						if field.IsValid() {
+							d.setColsValues(mmi, &field, mmi.fields.dbcols, trefs[:len(mmi.fields.dbcols)], tz)
+							for _, fi := range mmi.fields.fieldsReverse {
+								if fi.inModel && fi.reverseFieldInfo.mi == lastm {
+									if fi.reverseFieldInfo != nil {
+										f := field.FieldByIndex(fi.fieldIndex)
+										if f.Kind() == reflect.Ptr {
+											f.Set(last.Addr())
 										}
 									}
-									last = field
 								}
 							}
-							cacheV[names] = &field
-							cacheM[names] = mmi
+							last = field
 						}
 					}
-					trefs = trefs[len(mmi.fields.dbcols):]
-				}
-			}
-
-			if one {
-				ind.Set(mind)
-			} else {
-				if cnt == 0 {
-					// you can use a empty & caped container list
-					// orm will not replace it
-					if ind.Len() != 0 {
-						// if container is not empty
-						// create a new one
-						slice = reflect.New(ind.Type()).Elem()
-					}
-				}
-
-				if isPtr {
-					slice = reflect.Append(slice, mind.Addr())
-				} else {
-					slice = reflect.Append(slice, mind)
+					cacheV[names] = &field
+					cacheM[names] = mmi
 				}
 			}
+			trefs = trefs[len(mmi.fields.dbcols):]
 		}
-		cnt++
 	}
+	return mind
+}
 
-	if !one {
-		if cnt > 0 {
-			ind.Set(slice)
-		} else {
-			// when a result is empty and container is nil
-			// to set a empty container
-			if ind.IsNil() {
-				ind.Set(reflect.MakeSlice(ind.Type(), 0, 0))
-			}
-		}
+// open the rows of the records, the rows are streamed from sql.Rows.
+func (d *dbBaseClickHouse) ReadRows(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, cols []string) (RowsIterator, error) {
+	sel, err := d.selectQuery(qs, mi, cond, tz, cols)
+	if err != nil {
+		return nil, err
 	}
+	rs, err := q.QueryContext(ctx, sel.query, sel.args...)
+	if err != nil {
+		return nil, err
+	}
+	return &clickRows{d: d, rs: rs, sel: sel, mi: mi, tz: tz, refs: sel.newRefs()}, nil
+}
 
+// rows iterator of clickhouse.
+type clickRows struct {
+	d    *dbBaseClickHouse
+	rs   *sql.Rows
+	sel  *selectQuery
+	mi   *modelInfo
+	tz   *time.Location
+	refs []interface{}
+}
+
+func (r *clickRows) Next() bool {
+	return r.rs.Next()
+}
+
+// scan the current row into a pointer of the model.
+func (r *clickRows) Scan(ptr interface{}) error {
+	val := reflect.ValueOf(ptr)
+	if val.Kind() != reflect.Ptr || getFullName(val.Elem().Type()) != r.mi.fullName {
+		panic(fmt.Errorf("wrong object type `%T` for rows scan, need *%s", ptr, r.mi.fullName))
+	}
+	if err := r.rs.Scan(r.refs...); err != nil {
+		return err
+	}
+	val.Elem().Set(r.d.scanModel(r.sel, r.mi, r.refs, r.tz))
 	return nil
 }
 
+func (r *clickRows) Err() error {
+	return r.rs.Err()
+}
+
+func (r *clickRows) Close() error {
+	return r.rs.Close()
+}
+
 // get the recodes count.
-func (d *dbBaseClickHouse) Count(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (cnt int64, err error) {
+func (d *dbBaseClickHouse) Count(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (cnt int64, err error) {
 	tables := newDbTables(mi, d.ins)
 	tables.parseRelated(qs.related, qs.relDepth)
 
@@ -309,18 +431,13 @@ func (d *dbBaseClickHouse) Count(q dbQuerier, qs *querySet, mi *modelInfo, cond
 
 	d.ins.ReplaceMarks(&query)
 
-	var row *sql.Row
-	if qs != nil && qs.forContext {
-		row = q.QueryRowContext(qs.ctx, query, args...)
-	} else {
-		row = q.QueryRow(query, args...)
-	}
+	row := q.QueryRowContext(ctx, query, args...)
 	err = row.Scan(&cnt)
 	return
 }
 
 // update the recodes.
-func (d *dbBaseClickHouse) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, operator OperatorUpdate, params Params, tz *time.Location) (i int64, err error) {
+func (d *dbBaseClickHouse) UpdateBatch(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, operator OperatorUpdate, params Params, tz *time.Location) (i int64, err error) {
 	columns := make([]string, 0, len(params))
 	values := make([]interface{}, 0, len(params))
 	for col, val := range params {
@@ -380,21 +497,17 @@ func (d *dbBaseClickHouse) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo,
 
 	d.ins.ReplaceMarks(&query)
 
-	i, err = d.Count(q, qs, mi, cond, tz)
+	i, err = d.Count(ctx, q, qs, mi, cond, tz)
 	if err != nil {
 		return 0, err
 	}
 
-	if qs != nil && qs.forContext {
-		_, err = q.ExecContext(qs.ctx, query, values...)
-	} else {
-		_, err = q.Exec(query, values...)
-	}
+	_, err = q.ExecContext(ctx, query, values...)
 	return
 }
 
 // delete the recodes.
-func (d *dbBaseClickHouse) DeleteBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (i int64, err error) {
+func (d *dbBaseClickHouse) DeleteBatch(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (i int64, err error) {
 	tables := newDbTables(mi, d.ins)
 	tables.skipEnd = true
 
@@ -414,21 +527,17 @@ func (d *dbBaseClickHouse) DeleteBatch(q dbQuerier, qs *querySet, mi *modelInfo,
 	query := fmt.Sprintf("ALTER TABLE %s%s%s DELETE %s", Q, mi.table, Q, where)
 
 	d.ins.ReplaceMarks(&query)
-	if qs != nil && qs.forContext {
-		_, err = q.ExecContext(qs.ctx, query, args...)
-	} else {
-		_, err = q.Exec(query, args...)
-	}
+	_, err = q.ExecContext(ctx, query, args...)
 	if err != nil {
 		return
 	}
 
-	num, err := d.Count(q, qs, mi, cond, tz)
+	num, err := d.Count(ctx, q, qs, mi, cond, tz)
 	if err != nil {
 		return 0, err
 	}
 	if num > 0 {
-		err := d.deleteRels(q, mi, args, tz)
+		err := d.deleteRels(ctx, q, mi, args, tz)
 		if err != nil {
 			return num, err
 		}
@@ -437,7 +546,7 @@ func (d *dbBaseClickHouse) DeleteBatch(q dbQuerier, qs *querySet, mi *modelInfo,
 }
 
 // read one record.
-func (d *dbBaseClickHouse) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, container interface{}, tz *time.Location, cols []string, isForUpdate bool) (err error) {
+func (d *dbBaseClickHouse) Read(ctx context.Context, q dbQuerier, mi *modelInfo, ind reflect.Value, container interface{}, tz *time.Location, cols []string, isForUpdate bool) (err error) {
 	var whereCols []string
 	var args []interface{}
 
@@ -482,7 +591,7 @@ func (d *dbBaseClickHouse) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, c
 
 	d.ins.ReplaceMarks(&query)
 
-	row := q.QueryRow(query, args...)
+	row := q.QueryRowContext(ctx, query, args...)
 	if err := row.Scan(refs...); err != nil {
 		if err == sql.ErrNoRows {
 			return ErrNoRows
@@ -497,98 +606,164 @@ func (d *dbBaseClickHouse) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, c
 }
 
 // insert one record.
-func (d *dbBaseClickHouse) InsertOne(q dbQuerier, mi *modelInfo, ind reflect.Value, container interface{}, tz *time.Location) (id interface{}, err error) {
+func (d *dbBaseClickHouse) InsertOne(ctx context.Context, q dbQuerier, mi *modelInfo, ind reflect.Value, container interface{}, tz *time.Location) (id interface{}, err error) {
 	names := make([]string, 0, len(mi.fields.dbcols))
 	values, autoFields, err := d.collectValues(mi, ind, mi.fields.dbcols, false, true, &names, tz)
 	if err != nil {
 		return 0, err
 	}
-	q.Begin()
-	id, err = d.InsertValue(q, mi, false, names, values)
+	id, err = d.batch(ctx, q, func() (int64, error) {
+		return d.InsertValue(ctx, q, mi, false, names, values)
+	})
 	if err != nil {
-		q.Rollback()
 		return 0, err
 	}
-	q.Commit()
 	if len(autoFields) > 0 {
 		err = d.setval(q, mi, autoFields)
 	}
 	return id, err
 }
 
-// insert all records.
-func (d *dbBaseClickHouse) InsertMulti(q dbQuerier, mi *modelInfo, sind reflect.Value, bulk int, field interface{}, tz *time.Location) (ids interface{}, err error) {
+// ChunkError is the error of a chunk of InsertMulti, the rows of the chunk are not inserted.
+type ChunkError struct {
+	// index of the chunk and its first row in the inserted slice
+	Index  int
+	Offset int
+	Rows   int
+	Err    error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d (rows %d-%d): %s", e.Index, e.Offset, e.Offset+e.Rows-1, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is returned by InsertMulti of clickhouse when some chunks failed outside a transaction,
+// the other chunks are inserted and counted in Inserted.
+type BatchError struct {
+	Inserted int64
+	Chunks   []*ChunkError
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d chunks failed, %d rows inserted, first error: %s", len(e.Chunks), e.Inserted, e.Chunks[0])
+}
+
+// Unwrap return the error of the first failed chunk.
+func (e *BatchError) Unwrap() error {
+	return e.Chunks[0]
+}
+
+// insert all records, each chunk of bulk rows is sent as one native batch.
+// a failed chunk does not stop the others, the failures are returned as *BatchError.
+// inside a transaction the chunks share its batch, so the first failure is returned as it is,
+// the rows appended before it stay in the batch and the transaction must be rolled back.
+func (d *dbBaseClickHouse) InsertMulti(ctx context.Context, q dbQuerier, mi *modelInfo, sind reflect.Value, bulk int, field interface{}, tz *time.Location) (ids interface{}, err error) {
 	var (
-		cnt    int64
-		nums   int
-		values []interface{}
-		names  []string
+		cnt   int64
+		names []string
 	)
-	// typ := reflect.Indirect(mi.addrField).Type()
-
-	cols := make([]string, 0)
 
-	for _, v := range mi.fields.columns {
-		if !v.null {
-			cols = append(cols, v.column)
+	cols := make([]string, 0, len(mi.fields.fieldsDB))
+	for _, fi := range mi.fields.fieldsDB {
+		if !fi.null {
+			cols = append(cols, fi.column)
 		}
 	}
 
 	length, autoFields := sind.Len(), make([]string, 0, 1)
-	q.Begin()
-	for i := 1; i <= length; i++ {
-
-		ind := reflect.Indirect(sind.Index(i - 1))
-		// Is this needed ?
-		// if !ind.Type().AssignableTo(typ) {
-		// 	return cnt, ErrArgs
-		// }
-
-		if i == 1 {
-			var (
-				vus []interface{}
-				err error
-			)
-			vus, autoFields, err = d.collectValues(mi, ind, cols, false, true, &names, tz)
-			if err != nil {
-				return cnt, err
+	if bulk <= 0 {
+		bulk = length
+	}
+
+	db, ok := q.(*DB)
+	inTx := ok && db.isTx
+
+	batchErr := &BatchError{}
+	for start := 0; start < length; start += bulk {
+		end := start + bulk
+		if end > length {
+			end = length
+		}
+
+		values := make([]interface{}, 0, (end-start)*len(cols))
+		for i := start; i < end; i++ {
+			ind := reflect.Indirect(sind.Index(i))
+			if i == 0 {
+				var vus []interface{}
+				vus, autoFields, err = d.collectValues(mi, ind, cols, false, true, &names, tz)
+				if err != nil {
+					return cnt, err
+				}
+				values = append(values, vus...)
+				continue
 			}
-			values = make([]interface{}, bulk*len(vus))
-			nums += copy(values, vus)
-		} else {
+
 			vus, _, err := d.collectValues(mi, ind, cols, false, true, nil, tz)
 			if err != nil {
 				return cnt, err
 			}
-
 			if len(vus) != len(names) {
 				return cnt, ErrArgs
 			}
-
-			nums += copy(values[nums:], vus)
+			values = append(values, vus...)
 		}
 
-		if i > 1 && i%bulk == 0 || length == i {
-			num, err := d.InsertValue(q, mi, true, names, values[:nums])
-			if err != nil {
-				q.Rollback()
-				return cnt, err
+		num, err := d.batch(ctx, q, func() (int64, error) {
+			return d.InsertValue(ctx, q, mi, true, names, values)
+		})
+		if err != nil {
+			if inTx {
+				return 0, err
 			}
-			cnt += num
-			nums = 0
+			batchErr.Chunks = append(batchErr.Chunks, &ChunkError{
+				Index:  start / bulk,
+				Offset: start,
+				Rows:   end - start,
+				Err:    err,
+			})
+			continue
 		}
+		cnt += num
+	}
+
+	if len(batchErr.Chunks) > 0 {
+		batchErr.Inserted = cnt
+		return cnt, batchErr
 	}
-	q.Commit()
 	if len(autoFields) > 0 {
 		err = d.setval(q, mi, autoFields)
 	}
-
 	return cnt, err
 }
 
+// run fn in a transaction, which is the insert batch of clickhouse.
+// the running transaction of q is used if any, it's committed by the caller.
+func (d *dbBaseClickHouse) batch(ctx context.Context, q dbQuerier, fn func() (int64, error)) (int64, error) {
+	if db, ok := q.(*DB); ok && db.isTx {
+		return fn()
+	}
+	if err := q.BeginTx(ctx); err != nil {
+		return 0, err
+	}
+	cnt, err := fn()
+	if err != nil {
+		q.Rollback()
+		return 0, err
+	}
+	if err = q.Commit(); err != nil {
+		return 0, err
+	}
+	return cnt, nil
+}
+
 // execute insert sql with given struct and given values.
 // insert the given values, not the field values in struct.
-func (d *dbBaseClickHouse) InsertValue(q dbQuerier, mi *modelInfo, isMulti bool, names []string, values []interface{}) (cnt int64, err error) {
+// inside a transaction, the rows are appended to the native batch of the prepared statement.
+func (d *dbBaseClickHouse) InsertValue(ctx context.Context, q dbQuerier, mi *modelInfo, isMulti bool, names []string, values []interface{}) (cnt int64, err error) {
 	Q := d.ins.TableQuote()
 
 	marks := make([]string, len(names))
@@ -600,53 +775,55 @@ func (d *dbBaseClickHouse) InsertValue(q dbQuerier, mi *modelInfo, isMulti bool,
 	qmarks := strings.Join(marks, ", ")
 	columns := strings.Join(names, sep)
 
-	multi := len(values) / len(names)
-	cnt = int64(multi)
-
-	// if isMulti {
-	// 	qmarks = strings.Repeat(qmarks+"), (", multi-1) + qmarks
-	// }
-
 	query := fmt.Sprintf("INSERT INTO %s%s%s (%s%s%s) VALUES (%s)", Q, mi.table, Q, Q, columns, Q, qmarks)
 	d.ReplaceMarks(&query)
 
-	if isMulti || !d.HasReturningID(mi, &query) {
-		start := 0
-		end := 0
-		for i := 0; i < multi; i++ {
-			start = i * len(names)
-			end = (i + 1) * len(names)
-			_, err = q.Exec(query, values[start:end]...)
-			if err != nil {
-				cnt -= 1
-				continue
-			}
+	multi := len(values) / len(names)
+	for i := 0; i < multi; i++ {
+		start := i * len(names)
+		end := (i + 1) * len(names)
+		if _, err = q.ExecContext(ctx, query, values[start:end]...); err != nil {
+			return cnt, err
 		}
+		cnt++
 	}
 
-	return cnt, err
+	return cnt, nil
 }
 
-// update one record.
-func (d *dbBaseClickHouse) Update(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string) (id interface{}, err error) {
+// update one record by ALTER TABLE ... UPDATE, the id of the mutation is returned, or empty when it's not found.
+// the key columns are skipped when updating all columns, and refused when given by cols.
+func (d *dbBaseClickHouse) Update(ctx context.Context, q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string) (id interface{}, err error) {
 	pkName, pkValue, ok := getExistPk(mi, ind)
 	if !ok {
-		return 0, ErrMissPK
+		return "", ErrMissPK
 	}
 
-	var setNames []string
+	keys, err := d.tableColumns(ctx, q, mi.table, "is_in_sorting_key = 1 OR is_in_partition_key = 1")
+	if err != nil {
+		return "", err
+	}
 
-	// if specify cols length is zero, then commit all columns.
+	// if specify cols length is zero, then commit all columns except the keys.
 	if len(cols) == 0 {
-		cols = mi.fields.dbcols
-		setNames = make([]string, 0, len(mi.fields.dbcols)-1)
+		cols = make([]string, 0, len(mi.fields.dbcols))
+		for _, col := range mi.fields.dbcols {
+			if !keys[col] && col != pkName {
+				cols = append(cols, col)
+			}
+		}
 	} else {
-		setNames = make([]string, 0, len(cols))
+		for _, col := range cols {
+			if fi, ok := mi.fields.GetByAny(col); ok && keys[fi.column] {
+				return "", fmt.Errorf("%w `%s`", ErrKeyColumn, col)
+			}
+		}
 	}
+	setNames := make([]string, 0, len(cols))
 
 	setValues, _, err := d.collectValues(mi, ind, cols, true, false, &setNames, tz)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 
 	var findAutoNowAdd, findAutoNow bool
@@ -667,12 +844,15 @@ func (d *dbBaseClickHouse) Update(q dbQuerier, mi *modelInfo, ind reflect.Value,
 
 	if !findAutoNow {
 		for col, info := range mi.fields.columns {
-			if info.autoNow {
+			if info.autoNow && !keys[col] {
 				setNames = append(setNames, col)
 				setValues = append(setValues, time.Now())
 			}
 		}
 	}
+	if len(setNames) == 0 {
+		return "", ErrArgs
+	}
 
 	setValues = append(setValues, pkValue)
 
@@ -681,19 +861,139 @@ func (d *dbBaseClickHouse) Update(q dbQuerier, mi *modelInfo, ind reflect.Value,
 	sep := fmt.Sprintf("%s = ?, %s", Q, Q)
 	setColumns := strings.Join(setNames, sep)
 
-	query := fmt.Sprintf("UPDATE %s%s%s SET %s%s%s = ? WHERE %s%s%s = ?", Q, mi.table, Q, Q, setColumns, Q, Q, pkName, Q)
+	query := fmt.Sprintf("ALTER TABLE %s%s%s UPDATE %s%s%s = ? WHERE %s%s%s = ?", Q, mi.table, Q, Q, setColumns, Q, Q, pkName, Q)
+	wait := q.(*DB).mutationWait
+	switch wait {
+	case MutationSync:
+		query += " SETTINGS mutations_sync = 1"
+	case MutationSyncAll:
+		query += " SETTINGS mutations_sync = 2"
+	}
 
 	d.ins.ReplaceMarks(&query)
 
-	res, err := q.Exec(query, setValues...)
-	if err == nil {
-		return res.RowsAffected()
+	// the server time before the exec, the mutation is created after it.
+	var since int64
+	if err = q.QueryRowContext(ctx, "SELECT toUnixTimestamp(now())").Scan(&since); err != nil {
+		return "", err
+	}
+	if _, err = q.ExecContext(ctx, query, setValues...); err != nil {
+		return "", err
+	}
+	// the row is updated, an error of finding the mutation is not returned.
+	mutation := d.findMutation(ctx, q, mi.table, since, setNames, pkName, pkValue)
+	if mutation == "" || wait != MutationPoll {
+		return mutation, nil
+	}
+	return mutation, d.waitMutation(ctx, q, mi.table, mutation)
+}
+
+// find the id of the mutation created by Update since the unix time, it's best-effort,
+// an empty id is returned when it's not found. the same update of the same row at the
+// same time cannot be told apart, the first one is returned then.
+func (d *dbBaseClickHouse) findMutation(ctx context.Context, q dbQuerier, table string, since int64, columns []string, pkName string, pkValue interface{}) string {
+	query := "SELECT mutation_id, command FROM system.mutations WHERE database = currentDatabase() AND table = ? AND create_time >= toDateTime(?) ORDER BY create_time, mutation_id"
+	rs, err := q.QueryContext(ctx, query, table, since)
+	if err != nil {
+		return ""
+	}
+	defer rs.Close()
+
+	for rs.Next() {
+		var id, command string
+		if err = rs.Scan(&id, &command); err != nil {
+			return ""
+		}
+		if matchMutation(command, columns, pkName, pkValue) {
+			return id
+		}
+	}
+	return ""
+}
+
+// check the command of system.mutations is the UPDATE of the columns of the row,
+// e.g. "UPDATE message = 'a', level = 3 WHERE id = 1", the identifiers may be quoted.
+// the value of the pk is only compared when it's a string or an integer.
+func matchMutation(command string, columns []string, pkName string, pkValue interface{}) bool {
+	if !strings.HasPrefix(command, "UPDATE ") {
+		return false
+	}
+	literal, _ := mutationLiteral(pkValue)
+	sets, ok := trimWhere(command[len("UPDATE "):], pkName, literal)
+	if !ok {
+		return false
+	}
+
+	// each column is assigned at the start or after a comma
+	for _, col := range columns {
+		found := false
+		for _, ident := range []string{col, "`" + col + "`"} {
+			if strings.HasPrefix(sets, ident+" = ") || strings.Contains(sets, ", "+ident+" = ") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// cut the trailing " WHERE pk = literal" from the command, an empty literal matches any value.
+func trimWhere(command, pkName, literal string) (string, bool) {
+	for _, ident := range []string{pkName, "`" + pkName + "`"} {
+		where := " WHERE " + ident + " = "
+		if literal == "" {
+			if i := strings.LastIndex(command, where); i >= 0 {
+				return command[:i], true
+			}
+		} else if strings.HasSuffix(command, where+literal) {
+			return strings.TrimSuffix(command, where+literal), true
+		}
+	}
+	return "", false
+}
+
+// format the value as a literal of the command of system.mutations, only strings and integers.
+func mutationLiteral(v interface{}) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(val) + "'", true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(val), true
+	}
+	return "", false
+}
+
+// poll system.mutations until the mutation is done, or return the reason it failed.
+func (d *dbBaseClickHouse) waitMutation(ctx context.Context, q dbQuerier, table, id string) error {
+	ticker := time.NewTicker(MutationPollInterval)
+	defer ticker.Stop()
+
+	query := "SELECT is_done, latest_fail_reason FROM system.mutations WHERE database = currentDatabase() AND table = ? AND mutation_id = ?"
+	for {
+		var done uint8
+		var reason string
+		if err := q.QueryRowContext(ctx, query, table, id).Scan(&done, &reason); err != nil {
+			return err
+		}
+		if done == 1 {
+			return nil
+		}
+		if reason != "" {
+			return fmt.Errorf("mutation `%s` of `%s` failed: %s", id, table, reason)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
-	return 0, err
 }
 
 // delete one record.
-func (d *dbBaseClickHouse) Delete(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string) (cnt interface{}, err error) {
+func (d *dbBaseClickHouse) Delete(ctx context.Context, q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string) (cnt interface{}, err error) {
 	var whereCols []string
 	var args []interface{}
 	// if specify cols length > 0, then use it for where condition.
@@ -723,7 +1023,7 @@ func (d *dbBaseClickHouse) Delete(q dbQuerier, mi *modelInfo, ind reflect.Value,
 	query := fmt.Sprintf("ALTER TABLE %s%s%s DELETE WHERE %s%s%s = ?", Q, mi.table, Q, Q, wheres, Q)
 
 	d.ins.ReplaceMarks(&query)
-	res, err := q.Exec(query, args...)
+	res, err := q.ExecContext(ctx, query, args...)
 	if err == nil {
 		num, err := res.RowsAffected()
 		if err != nil {
@@ -737,7 +1037,7 @@ func (d *dbBaseClickHouse) Delete(q dbQuerier, mi *modelInfo, ind reflect.Value,
 					ind.FieldByIndex(mi.fields.pk.fieldIndex).SetInt(0)
 				}
 			}
-			err := d.deleteRels(q, mi, args, tz)
+			err := d.deleteRels(ctx, q, mi, args, tz)
 			if err != nil {
 				return num, err
 			}
@@ -748,13 +1048,13 @@ func (d *dbBaseClickHouse) Delete(q dbQuerier, mi *modelInfo, ind reflect.Value,
 }
 
 // do UpdateBanch or DeleteBanch by condition of tables' relationship.
-func (d *dbBaseClickHouse) deleteRels(q dbQuerier, mi *modelInfo, args []interface{}, tz *time.Location) error {
+func (d *dbBaseClickHouse) deleteRels(ctx context.Context, q dbQuerier, mi *modelInfo, args []interface{}, tz *time.Location) error {
 	for _, fi := range mi.fields.fieldsReverse {
 		fi = fi.reverseFieldInfo
 		switch fi.onDelete {
 		case odCascade:
 			cond := NewCondition().And(fmt.Sprintf("%s__in", fi.name), args...)
-			_, err := d.DeleteBatch(q, nil, fi.mi, cond, tz)
+			_, err := d.DeleteBatch(ctx, q, nil, fi.mi, cond, tz)
 			if err != nil {
 				return err
 			}
@@ -764,7 +1064,7 @@ func (d *dbBaseClickHouse) deleteRels(q dbQuerier, mi *modelInfo, args []interfa
 			if fi.onDelete == odSetDefault {
 				params[fi.column] = fi.initial.String()
 			}
-			_, err := d.UpdateBatch(q, nil, fi.mi, cond, OpDefault, params, tz)
+			_, err := d.UpdateBatch(ctx, q, nil, fi.mi, cond, OpDefault, params, tz)
 			if err != nil {
 				return err
 			}
@@ -774,13 +1074,151 @@ func (d *dbBaseClickHouse) deleteRels(q dbQuerier, mi *modelInfo, args []interfa
 	return nil
 }
 
+// query the aggregates of each group, save to *[]Params.
+func (d *dbBaseClickHouse) ReadAnnotates(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, anns []Annotation, results *[]Params, tz *time.Location) (int64, error) {
+	query, args, infos := d.annotateSQL(qs, mi, cond, anns, tz)
+	rs, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rs.Close()
+
+	columns, err := rs.Columns()
+	if err != nil {
+		return 0, err
+	}
+	refs := make([]interface{}, len(infos))
+	for i := range refs {
+		var ref interface{}
+		refs[i] = &ref
+	}
+
+	res := []Params{}
+	for rs.Next() {
+		if err := rs.Scan(refs...); err != nil {
+			return 0, err
+		}
+		params := make(Params, len(infos))
+		for i, ref := range refs {
+			val := reflect.Indirect(reflect.ValueOf(ref)).Interface()
+			if fi := infos[i]; fi != nil {
+				value, err := d.convertValueFromDB(fi, val, tz)
+				if err != nil {
+					panic(fmt.Errorf("db value convert failed `%v` %s", val, err.Error()))
+				}
+				val = value
+			}
+			params[columns[i]] = val
+		}
+		res = append(res, params)
+	}
+	if err = rs.Err(); err != nil {
+		return 0, err
+	}
+
+	*results = res
+	return int64(len(res)), nil
+}
+
+// get the query of ReadAnnotates, and the fields of the columns whose values keep the field type.
+// sum, avg, min and max are NULL when nothing matched, like mongodb.
+func (d *dbBaseClickHouse) annotateSQL(qs *querySet, mi *modelInfo, cond *Condition, anns []Annotation, tz *time.Location) (string, []interface{}, []*fieldInfo) {
+	tables := newDbTables(mi, d.ins)
+	Q := d.ins.TableQuote()
+
+	var (
+		cols  = make([]string, 0, len(qs.groups)+len(anns))
+		infos = make([]*fieldInfo, 0, len(qs.groups)+len(anns))
+		names = make(map[string]bool, len(anns))
+	)
+
+	column := func(expr string) (string, *fieldInfo) {
+		index, _, fi, suc := tables.parseExprs(mi, strings.Split(expr, ExprSep))
+		if !suc {
+			panic(fmt.Errorf("unknown field/column name `%s`", expr))
+		}
+		return fmt.Sprintf("%s.%s%s%s", index, Q, fi.column, Q), fi
+	}
+
+	for _, group := range qs.groups {
+		col, fi := column(group)
+		cols = append(cols, fmt.Sprintf("%s %s%s%s", col, Q, group, Q))
+		infos = append(infos, fi)
+	}
+
+	for _, ann := range anns {
+		var (
+			col  string
+			fi   *fieldInfo
+			expr string
+		)
+		if ann.Field != "" {
+			col, fi = column(ann.Field)
+		} else if ann.Func != AggCount {
+			panic(fmt.Errorf("aggregate function `%s` need a field", ann.Func))
+		}
+
+		switch ann.Func {
+		case AggSum, AggAvg, AggMin, AggMax:
+			expr = fmt.Sprintf("%sOrNull(%s)", ann.Func, col)
+		case AggCount:
+			expr = fmt.Sprintf("count(%s)", col)
+		case AggCountDistinct:
+			expr = fmt.Sprintf("count(DISTINCT %s)", col)
+		default:
+			panic(fmt.Errorf("unknown aggregate function `%s`", ann.Func))
+		}
+		// only min and max keep the type of the field
+		if ann.Func != AggMin && ann.Func != AggMax {
+			fi = nil
+		}
+		cols = append(cols, fmt.Sprintf("%s %s%s%s", expr, Q, ann.Name, Q))
+		infos = append(infos, fi)
+		names[ann.Name] = true
+	}
+
+	orderBy := ""
+	if len(qs.orders) > 0 {
+		orders := make([]string, 0, len(qs.orders))
+		for _, order := range qs.orders {
+			asc := "ASC"
+			if order[0] == '-' {
+				asc = "DESC"
+				order = order[1:]
+			}
+			col := Q + order + Q
+			if !names[order] {
+				col, _ = column(order)
+			}
+			orders = append(orders, fmt.Sprintf("%s %s", col, asc))
+		}
+		orderBy = fmt.Sprintf("ORDER BY %s ", strings.Join(orders, ", "))
+	}
+
+	where, args := tables.getCondSQL(cond, false, tz)
+	groupBy := tables.getGroupSQL(qs.groups)
+	limit := tables.getLimitSQL(mi, qs.offset, qs.limit)
+	join := tables.getJoinSQL()
+
+	sels := strings.Join(cols, ", ")
+	query := fmt.Sprintf("SELECT %s FROM %s%s%s T0 %s%s%s%s%s", sels, Q, mi.table, Q, join, where, groupBy, orderBy, limit)
+
+	d.ins.ReplaceMarks(&query)
+	return query, args, infos
+}
+
+// aggregation pipeline is only supported by mongodb.
+func (d *dbBaseClickHouse) Aggregate(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, pipeline []bson.D, container interface{}, one bool, tz *time.Location) error {
+	return ErrNotImplement
+}
+
 // get indexview.
 func (d *dbBaseClickHouse) Indexes(qs *querySet, mi *modelInfo, tz *time.Location) (iv IndexViewer) {
 	return
 }
 
 // query sql, read values , save to *[]ParamList.
-func (d *dbBaseClickHouse) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, exprs []string, container interface{}, tz *time.Location) (int64, error) {
+func (d *dbBaseClickHouse) ReadValues(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, exprs []string, container interface{}, tz *time.Location) (int64, error) {
 
 	var (
 		maps  []Params
@@ -859,7 +1297,7 @@ func (d *dbBaseClickHouse) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo,
 
 	d.ins.ReplaceMarks(&query)
 
-	rs, err := q.Query(query, args...)
+	rs, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -948,3 +1386,280 @@ func (d *dbBaseClickHouse) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo,
 
 	return cnt, nil
 }
+
+// clickhouse types of the field types, the go kinds int, uint and float32 are checked by clickType.
+var clickTypes = map[int]string{
+	TypeBooleanField:              "UInt8",
+	TypeVarCharField:              "String",
+	TypeCharField:                 "String",
+	TypeTextField:                 "String",
+	TypeTimeField:                 "String",
+	TypeDateField:                 "Date",
+	TypeDateTimeField:             "DateTime",
+	TypeBitField:                  "Int8",
+	TypeSmallIntegerField:         "Int16",
+	TypeIntegerField:              "Int32",
+	TypeBigIntegerField:           "Int64",
+	TypePositiveBitField:          "UInt8",
+	TypePositiveSmallIntegerField: "UInt16",
+	TypePositiveIntegerField:      "UInt32",
+	TypePositiveBigIntegerField:   "UInt64",
+	TypeFloatField:                "Float64",
+	TypeJSONField:                 "String",
+	TypeJsonbField:                "String",
+}
+
+// get the clickhouse type of the go type typ, ft is its field type.
+func clickType(ft int, typ reflect.Type) (string, bool) {
+	if typ == nil {
+		t, ok := clickTypes[ft]
+		return t, ok
+	}
+	switch {
+	case ft == TypeSlice:
+		elem := typ.Elem()
+		if elem.Kind() == reflect.Uint8 {
+			return "String", true
+		}
+		if elem.Kind() == reflect.Ptr {
+			return "", false
+		}
+		eft, err := getFieldType(reflect.New(elem))
+		if err != nil {
+			return "", false
+		}
+		t, ok := clickType(eft, elem)
+		return "Array(" + t + ")", ok
+	case typ.Kind() == reflect.Int:
+		return "Int64", true
+	case typ.Kind() == reflect.Uint:
+		return "UInt64", true
+	case typ.Kind() == reflect.Float32:
+		return "Float32", true
+	}
+	t, ok := clickTypes[ft]
+	return t, ok
+}
+
+// get the column type of the field, the type tag is used as it is if it's not a orm type.
+func (d *dbBaseClickHouse) columnType(fi *fieldInfo) (typ string, err error) {
+	switch {
+	case fi.dbType != "":
+		typ = fi.dbType
+	case fi.fieldType == RelForeignKey || fi.fieldType == RelOneToOne:
+		typ, err = d.columnType(fi.relModelInfo.fields.pk)
+		typ = strings.TrimSuffix(strings.TrimPrefix(typ, "Nullable("), ")")
+	case fi.fieldType == TypeCharField && !fi.toText:
+		typ = fmt.Sprintf("FixedString(%d)", fi.size)
+	case fi.fieldType == TypeDecimalField:
+		typ = fmt.Sprintf("Decimal(%d, %d)", fi.digits, fi.decimals)
+	default:
+		var ok bool
+		if typ, ok = clickType(fi.fieldType, fi.sf.Type); !ok {
+			err = fmt.Errorf("field `%s` type `%s` is not supported by clickhouse, use the type tag", fi.fullName, fi.sf.Type)
+		}
+	}
+	if err != nil {
+		return
+	}
+	// arrays can not be inside Nullable
+	if fi.null && !strings.HasPrefix(typ, "Nullable(") && !strings.HasPrefix(typ, "Array(") {
+		typ = "Nullable(" + typ + ")"
+	}
+	return
+}
+
+// get the column definition of the field with its default value and comment.
+func (d *dbBaseClickHouse) columnSQL(fi *fieldInfo) (string, error) {
+	Q := d.ins.TableQuote()
+	typ, err := d.columnType(fi)
+	if err != nil {
+		return "", err
+	}
+	column := fmt.Sprintf("%s%s%s %s", Q, fi.column, Q, typ)
+	if fi.initial.Exist() {
+		def := fi.initial.String()
+		switch fi.fieldType {
+		case TypeBooleanField:
+			def = "0"
+			if b, _ := fi.initial.Bool(); b {
+				def = "1"
+			}
+		case TypeVarCharField, TypeCharField, TypeTextField, TypeJSONField, TypeJsonbField:
+			def = clickQuote(def)
+		case TypeTimeField, TypeDateField, TypeDateTimeField:
+			// a function call like now() is an expression, not a time literal
+			if !strings.HasSuffix(def, ")") {
+				def = clickQuote(def)
+			}
+		}
+		column += " DEFAULT " + def
+	}
+	if fi.description != "" {
+		column += " COMMENT " + clickQuote(fi.description)
+	}
+	return column, nil
+}
+
+// get the sorting key of the table: the pk, the fields with index tag and the columns of TableIndex.
+func clickSortingKey(mi *modelInfo) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if fi, ok := mi.fields.GetByAny(name); ok {
+			name = fi.column
+		}
+		if !seen[name] {
+			seen[name] = true
+			keys = append(keys, name)
+		}
+	}
+	if mi.fields.pk != nil {
+		add(mi.fields.pk.column)
+	}
+	for _, fi := range mi.fields.fieldsDB {
+		if fi.index {
+			add(fi.column)
+		}
+	}
+	for _, index := range getTableIndex(mi.addrField) {
+		for _, name := range index {
+			add(name)
+		}
+	}
+	return keys
+}
+
+// get the CREATE TABLE statement of the model, the engine is MergeTree() unless TableEngine is defined.
+// the ORDER BY, PARTITION BY, TTL and SETTINGS clauses are only used by the MergeTree family.
+// the columns of the sorting key cannot be Nullable.
+func (d *dbBaseClickHouse) createTableSQL(mi *modelInfo) (string, error) {
+	Q := d.ins.TableQuote()
+	engine := getTableEngine(mi.addrField)
+	if engine == "" {
+		engine = "MergeTree()"
+	}
+	mergeTree := strings.Contains(engine, "MergeTree")
+
+	keys := clickSortingKey(mi)
+	isKey := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		isKey[key] = true
+	}
+
+	columns := make([]string, 0, len(mi.fields.fieldsDB))
+	for _, fi := range mi.fields.fieldsDB {
+		if mergeTree && isKey[fi.column] && fi.null {
+			return "", fmt.Errorf("field `%s` is in the sorting key of clickhouse, it cannot be null", fi.fullName)
+		}
+		column, err := d.columnSQL(fi)
+		if err != nil {
+			return "", err
+		}
+		columns = append(columns, "    "+column)
+	}
+
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s%s%s (\n%s\n) ENGINE = %s", Q, mi.table, Q, strings.Join(columns, ",\n"), engine)
+	if !mergeTree {
+		return query, nil
+	}
+
+	if partition := getTablePartition(mi.addrField); partition != "" {
+		query += "\nPARTITION BY " + partition
+	}
+	for i, key := range keys {
+		keys[i] = Q + key + Q
+	}
+	if len(keys) == 0 {
+		query += "\nORDER BY tuple()"
+	} else {
+		query += fmt.Sprintf("\nORDER BY (%s)", strings.Join(keys, ", "))
+	}
+	if ttl := getTableTTL(mi.addrField); ttl != "" {
+		query += "\nTTL " + ttl
+	}
+	if settings := getTableSettings(mi.addrField); settings != "" {
+		query += "\nSETTINGS " + settings
+	}
+	return query, nil
+}
+
+// get the columns of the table in the current database matching the where, it's empty if the table not exists.
+func (d *dbBaseClickHouse) tableColumns(ctx context.Context, q dbQuerier, table string, where string) (map[string]bool, error) {
+	query := "SELECT name FROM system.columns WHERE database = currentDatabase() AND table = ?"
+	if where != "" {
+		query += " AND (" + where + ")"
+	}
+	rows, err := q.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// create the table of the model, or add the columns missing in the existing table.
+func (d *dbBaseClickHouse) SyncTable(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, opts SyncOptions) error {
+	Q := d.ins.TableQuote()
+	exec := func(query string) error {
+		if opts.Verbose || opts.DryRun {
+			fmt.Printf("%s;\n", query)
+		}
+		if opts.DryRun {
+			return nil
+		}
+		_, err := q.ExecContext(ctx, query)
+		return err
+	}
+
+	if opts.Force {
+		if err := exec(fmt.Sprintf("DROP TABLE IF EXISTS %s%s%s", Q, mi.table, Q)); err != nil {
+			return err
+		}
+	}
+	columns, err := d.tableColumns(ctx, q, mi.table, "")
+	if err != nil {
+		return err
+	}
+	// the dropped table is still there in dry run
+	if len(columns) == 0 || opts.Force {
+		query, err := d.createTableSQL(mi)
+		if err != nil {
+			return err
+		}
+		return exec(query)
+	}
+
+	prev := ""
+	for _, fi := range mi.fields.fieldsDB {
+		if !columns[fi.column] {
+			column, err := d.columnSQL(fi)
+			if err != nil {
+				return err
+			}
+			query := fmt.Sprintf("ALTER TABLE %s%s%s ADD COLUMN IF NOT EXISTS %s", Q, mi.table, Q, column)
+			if prev != "" {
+				query += fmt.Sprintf(" AFTER %s%s%s", Q, prev, Q)
+			}
+			if err = exec(query); err != nil {
+				return err
+			}
+		}
+		prev = fi.column
+	}
+	return nil
+}
+
+// quote the string literal of clickhouse.
+func clickQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,263 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type clickEvent struct {
+	Time    time.Time `orm:"pk;column(_time)"`
+	Date    time.Time `orm:"column(_date);type(date)"`
+	Level   string    `orm:"index;type(LowCardinality(String));description(log level)"`
+	Code    string    `orm:"type(char);size(3)"`
+	Count   int       `orm:"default(1)"`
+	Tags    []string
+	Message string    `orm:"null;default(it's)"`
+	Updated time.Time `orm:"default(1970-01-01 00:00:00)"`
+	Day     time.Time `orm:"type(date);default(today())"`
+}
+
+func (e *clickEvent) TablePartition() string { return "toYYYYMM(_date)" }
+func (e *clickEvent) TableTTL() string       { return "_date + INTERVAL 30 DAY" }
+func (e *clickEvent) TableSettings() string  { return "index_granularity = 8192" }
+
+func TestCreateTableSQL(t *testing.T) {
+	mi := newModelInfo(reflect.ValueOf(new(clickEvent)))
+	mi.table = "event"
+
+	got, err := newdbBaseClickHouse().(*dbBaseClickHouse).createTableSQL(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CREATE TABLE IF NOT EXISTS `event` (\n" +
+		"    `_time` DateTime,\n" +
+		"    `_date` Date,\n" +
+		"    `level` LowCardinality(String) COMMENT 'log level',\n" +
+		"    `code` FixedString(3),\n" +
+		"    `count` Int64 DEFAULT 1,\n" +
+		"    `tags` Array(String),\n" +
+		"    `message` Nullable(String) DEFAULT 'it\\'s',\n" +
+		"    `updated` DateTime DEFAULT '1970-01-01 00:00:00',\n" +
+		"    `day` Date DEFAULT today()\n" +
+		") ENGINE = MergeTree()\n" +
+		"PARTITION BY toYYYYMM(_date)\n" +
+		"ORDER BY (`_time`, `level`)\n" +
+		"TTL _date + INTERVAL 30 DAY\n" +
+		"SETTINGS index_granularity = 8192"
+	if got != want {
+		t.Errorf("createTableSQL() = %s, want %s", got, want)
+	}
+}
+
+type clickNullKey struct {
+	Id    int64  `orm:"pk"`
+	Level string `orm:"index;null"`
+}
+
+func TestCreateTableNullableKey(t *testing.T) {
+	mi := newModelInfo(reflect.ValueOf(new(clickNullKey)))
+	mi.table = "null_key"
+
+	_, err := newdbBaseClickHouse().(*dbBaseClickHouse).createTableSQL(mi)
+	if err == nil || !strings.Contains(err.Error(), "sorting key") {
+		t.Errorf("createTableSQL() err = %v, want the nullable sorting key error", err)
+	}
+}
+
+func TestAnnotateSQL(t *testing.T) {
+	mi := newModelInfo(reflect.ValueOf(new(clickEvent)))
+	mi.table = "event"
+	d := newdbBaseClickHouse().(*dbBaseClickHouse)
+
+	qs := &querySet{groups: []string{"level"}, orders: []string{"-total", "level"}, limit: 10}
+	query, args, infos := d.annotateSQL(qs, mi, NewCondition().And("code", "E01"), []Annotation{
+		{Name: "total", Func: AggSum, Field: "count"},
+		{Name: "first", Func: AggMin, Field: "time"},
+		{Name: "num", Func: AggCount},
+		{Name: "codes", Func: AggCountDistinct, Field: "code"},
+	}, time.UTC)
+
+	want := "SELECT T0.`level` `level`, sumOrNull(T0.`count`) `total`, minOrNull(T0.`_time`) `first`, " +
+		"count() `num`, count(DISTINCT T0.`code`) `codes` FROM `event` T0 WHERE T0.`code` = ? " +
+		"GROUP BY T0.`level` ORDER BY `total` DESC, T0.`level` ASC LIMIT 10"
+	if query != want {
+		t.Errorf("annotateSQL() = %s, want %s", query, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"E01"}) {
+		t.Errorf("annotateSQL() args = %v", args)
+	}
+
+	// the group and min keep the type of the field
+	names := make([]string, 0, len(infos))
+	for _, fi := range infos {
+		name := ""
+		if fi != nil {
+			name = fi.name
+		}
+		names = append(names, name)
+	}
+	if wantNames := []string{"Level", "", "Time", "", ""}; !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("annotateSQL() fields = %v, want %v", names, wantNames)
+	}
+}
+
+// batchQuerier record the rows of the committed insert batches, the row of code "bad" fails its batch.
+type batchQuerier struct {
+	dbQuerier
+	pending   []string
+	committed []string
+	batches   int
+}
+
+func (q *batchQuerier) BeginTx(ctx context.Context) error {
+	q.pending = nil
+	q.batches++
+	return nil
+}
+
+func (q *batchQuerier) Commit() error {
+	q.committed = append(q.committed, q.pending...)
+	return nil
+}
+
+func (q *batchQuerier) Rollback() error {
+	q.pending = nil
+	return nil
+}
+
+func (q *batchQuerier) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	for _, arg := range args {
+		if arg == "bad" {
+			return nil, errors.New("bad row")
+		}
+	}
+	// the columns are _time, _date, level, code, ...
+	q.pending = append(q.pending, args[3].(string))
+	return nil, nil
+}
+
+func TestInsertMultiChunks(t *testing.T) {
+	mi := newModelInfo(reflect.ValueOf(new(clickEvent)))
+	mi.table = "event"
+	d := newdbBaseClickHouse().(*dbBaseClickHouse)
+
+	events := func(bad ...int) []*clickEvent {
+		res := make([]*clickEvent, 7)
+		for i := range res {
+			res[i] = &clickEvent{Time: time.Unix(int64(i), 0), Code: strconv.Itoa(i)}
+		}
+		for _, i := range bad {
+			res[i].Code = "bad"
+		}
+		return res
+	}
+
+	cases := []struct {
+		name      string
+		bulk      int
+		bad       []int
+		inserted  int64
+		batches   int
+		committed string
+		chunks    []ChunkError
+	}{
+		{name: "all", bulk: 3, inserted: 7, batches: 3, committed: "0123456"},
+		{name: "one batch", bulk: 0, inserted: 7, batches: 1, committed: "0123456"},
+		{
+			name: "middle chunk", bulk: 3, bad: []int{4}, inserted: 4, batches: 3, committed: "0126",
+			chunks: []ChunkError{{Index: 1, Offset: 3, Rows: 3}},
+		},
+		{
+			name: "first and last chunk", bulk: 3, bad: []int{0, 6}, inserted: 3, batches: 3, committed: "345",
+			chunks: []ChunkError{{Index: 0, Offset: 0, Rows: 3}, {Index: 2, Offset: 6, Rows: 1}},
+		},
+		{
+			name: "bulk larger than rows", bulk: 10, bad: []int{6}, inserted: 0, batches: 1, committed: "",
+			chunks: []ChunkError{{Index: 0, Offset: 0, Rows: 7}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := new(batchQuerier)
+			rows := events(c.bad...)
+			cnt, err := d.InsertMulti(context.Background(), q, mi, reflect.ValueOf(rows), c.bulk, rows, time.UTC)
+
+			if cnt != c.inserted || q.batches != c.batches || strings.Join(q.committed, "") != c.committed {
+				t.Errorf("InsertMulti() = %v in %d batches, committed %v, want %d in %d batches, committed %s",
+					cnt, q.batches, q.committed, c.inserted, c.batches, c.committed)
+			}
+			if len(c.chunks) == 0 {
+				if err != nil {
+					t.Errorf("InsertMulti() err = %v", err)
+				}
+				return
+			}
+
+			var batchErr *BatchError
+			if !errors.As(err, &batchErr) {
+				t.Fatalf("InsertMulti() err = %v, want *BatchError", err)
+			}
+			if batchErr.Inserted != c.inserted || len(batchErr.Chunks) != len(c.chunks) {
+				t.Fatalf("BatchError = %v, want %d inserted and %d chunks", batchErr, c.inserted, len(c.chunks))
+			}
+			for i, chunk := range batchErr.Chunks {
+				want := c.chunks[i]
+				if chunk.Index != want.Index || chunk.Offset != want.Offset || chunk.Rows != want.Rows || chunk.Err.Error() != "bad row" {
+					t.Errorf("chunk %d = %+v, want %+v", i, *chunk, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchError(t *testing.T) {
+	cause := errors.New("bad row")
+	err := error(&BatchError{Inserted: 4, Chunks: []*ChunkError{
+		{Index: 1, Offset: 3, Rows: 3, Err: cause},
+		{Index: 2, Offset: 6, Rows: 1, Err: errors.New("other")},
+	}})
+
+	if want := "2 chunks failed, 4 rows inserted, first error: chunk 1 (rows 3-5): bad row"; err.Error() != want {
+		t.Errorf("Error() = %s, want %s", err, want)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("BatchError does not unwrap to the error of the first chunk")
+	}
+	var chunk *ChunkError
+	if !errors.As(err, &chunk) || chunk.Offset != 3 {
+		t.Errorf("errors.As() chunk = %v, want the first chunk", chunk)
+	}
+}
+
+func TestMatchMutation(t *testing.T) {
+	columns := []string{"message", "updated"}
+	cases := []struct {
+		name    string
+		command string
+		pk      interface{}
+		want    bool
+	}{
+		{"update of the row", "UPDATE message = 'a', updated = now() WHERE id = 5", 5, true},
+		{"quoted identifiers", "UPDATE `message` = 'a', `updated` = now() WHERE `id` = 5", int64(5), true},
+		{"string pk", `UPDATE message = 'a', updated = now() WHERE id = 'it\'s'`, "it's", true},
+		{"pk of other type", "UPDATE message = 'a', updated = now() WHERE id = toUUID('x')", 1.5, true},
+		{"other row", "UPDATE message = 'a', updated = now() WHERE id = 15", 5, false},
+		{"other columns", "UPDATE message_id = 'a', last_updated = now() WHERE id = 5", 5, false},
+		{"column in a value", "UPDATE updated = 'message = 1' WHERE id = 5", 5, false},
+		{"delete", "DELETE WHERE id = 5", 5, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := matchMutation(c.command, columns, "id", c.pk); got != c.want {
+				t.Errorf("matchMutation(%q) = %v, want %v", c.command, got, c.want)
+			}
+		})
+	}
+}
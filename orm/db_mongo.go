@@ -1,11 +1,17 @@
 package orm
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -25,6 +31,76 @@ var (
 	MgoSetOnInsert OperatorUpdate = "$setOnInsert"
 )
 
+// mongodb operators whose name is not "$" + lookup.
+var mongoOperators = map[string]string{
+	"elemmatch": "$elemMatch",
+}
+
+// mongodb error labels and codes of transaction errors.
+const (
+	TransientTransactionError      = "TransientTransactionError"
+	UnknownTransactionCommitResult = "UnknownTransactionCommitResult"
+	mgoWriteConflictCode           = 112
+)
+
+var (
+	ErrTxWriteConflict = errors.New("<Ormer> transaction write conflict")
+	ErrTxWriteConcern  = errors.New("<Ormer.WriteConcern> write concern of a transaction is set before Begin")
+)
+
+// TxError is returned by operations and commits of a mongodb transaction
+// when the server reports a write conflict or labels the error as retryable.
+// errors.Is(err, ErrTxWriteConflict) reports the write conflict case.
+type TxError struct {
+	Err error
+}
+
+func (e *TxError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// Is match ErrTxWriteConflict.
+func (e *TxError) Is(target error) bool {
+	return target == ErrTxWriteConflict && e.IsWriteConflict()
+}
+
+// IsWriteConflict check the transaction lost a write conflict.
+func (e *TxError) IsWriteConflict() bool {
+	var se mongo.ServerError
+	return errors.As(e.Err, &se) && se.HasErrorCode(mgoWriteConflictCode)
+}
+
+// HasErrorLabel check the server attached the label to the error.
+func (e *TxError) HasErrorLabel(label string) bool {
+	var se mongo.ServerError
+	return errors.As(e.Err, &se) && se.HasErrorLabel(label)
+}
+
+// wrap transaction related server errors, others are returned as they are.
+func newTxError(err error) error {
+	var se mongo.ServerError
+	if err == nil || !errors.As(err, &se) {
+		return err
+	}
+	if se.HasErrorCode(mgoWriteConflictCode) ||
+		se.HasErrorLabel(TransientTransactionError) ||
+		se.HasErrorLabel(UnknownTransactionCommitResult) {
+		return &TxError{Err: err}
+	}
+	return err
+}
+
+// check the whole transaction can be retried.
+func isRetryableTxError(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) &&
+		(se.HasErrorLabel(TransientTransactionError) || se.HasErrorLabel(UnknownTransactionCommitResult))
+}
+
 // mysql dbBaser implementation.
 type dbBaseMongo struct {
 	dbBase
@@ -40,9 +116,10 @@ func newdbBaseMongo() dbBaser {
 }
 
 // read one record.
-func (d *dbBaseMongo) FindOne(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, container interface{}, tz *time.Location, cols []string) (err error) {
-	db := qs.orm.db.(*DB).MDB
-	col := db.Collection(mi.table)
+func (d *dbBaseMongo) FindOne(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, container interface{}, tz *time.Location, cols []string) (err error) {
+	db := q.(*DB)
+	col := d.collection(db, qs, mi)
+	ctx = db.sessionContext(ctx)
 	opt := options.FindOne()
 	if len(cols) > 0 {
 		projection := bson.M{}
@@ -60,54 +137,73 @@ func (d *dbBaseMongo) FindOne(q dbQuerier, qs *querySet, mi *modelInfo, cond *Co
 		opt.SetSkip(qs.offset)
 	}
 
-	filter := convertCondition(cond)
+	filter := convertCondition(mi, cond)
 
-	if qs != nil && qs.forContext {
-		err = col.FindOne(qs.ctx, filter, opt).Decode(container)
-	} else {
-		err = col.FindOne(todo, filter, opt).Decode(container)
-	}
-
-	return
+	err = col.FindOne(ctx, filter, opt).Decode(container)
+	return db.txError(err)
 }
 
-// read one record.
-func (d *dbBaseMongo) Distinct(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, field string) (res []interface{}, err error) {
-	db := qs.orm.db.(*DB).MDB
-	col := db.Collection(mi.table)
+// read the distinct values of field.
+func (d *dbBaseMongo) Distinct(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, field string) (res []interface{}, err error) {
+	db := q.(*DB)
+	col := d.collection(db, qs, mi)
+	ctx = db.sessionContext(ctx)
 	opt := options.Distinct()
 
-	filter := convertCondition(cond)
+	filter := convertCondition(mi, cond)
 
-	if qs != nil && qs.forContext {
-		return col.Distinct(qs.ctx, field, filter, opt)
-	} else {
-		return col.Distinct(todo, field, filter, opt)
-	}
+	res, err = col.Distinct(ctx, valuePath(mi, field), filter, opt)
+	return res, db.txError(err)
 }
 
 // read all records.
-func (d *dbBaseMongo) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, container interface{}, tz *time.Location, cols []string) (err error) {
-	db := qs.orm.db.(*DB).MDB
-	col := db.Collection(mi.table)
-	cur := &mongo.Cursor{}
+func (d *dbBaseMongo) ReadBatch(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, container interface{}, tz *time.Location, cols []string) (err error) {
+	db := q.(*DB)
+	ctx = db.sessionContext(ctx)
 
-	if len(qs.groups) > 0 {
-		opt := options.Aggregate()
-		aggre := convertAggre(qs.groups, qs.cond, qs.orders)
-		if qs != nil && qs.forContext {
-			// Do something with content
-			cur, err = col.Aggregate(qs.ctx, aggre, opt)
+	cur, err := d.find(ctx, db, qs, mi, cond, cols)
+	if err != nil {
+		return db.txError(err)
+	}
+	err = cur.All(ctx, container)
+	return db.txError(err)
+}
+
+// open the rows of the records, the documents are fetched by the batch size of QuerySeter.
+func (d *dbBaseMongo) ReadRows(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, cols []string) (RowsIterator, error) {
+	db := q.(*DB)
+	ctx = db.sessionContext(ctx)
+
+	cur, err := d.find(ctx, db, qs, mi, cond, cols)
+	if err != nil {
+		return nil, db.txError(err)
+	}
+	return &mongoRows{ctx: ctx, db: db, cur: cur}, nil
+}
+
+// open the cursor of the records of ReadBatch and ReadRows.
+func (d *dbBaseMongo) find(ctx context.Context, db *DB, qs *querySet, mi *modelInfo, cond *Condition, cols []string) (*mongo.Cursor, error) {
+	col := d.collection(db, qs, mi)
+
+	if len(qs.groups) > 0 || qs.distinct {
+		var pipeline []bson.D
+		if len(qs.groups) > 0 {
+			pipeline = convertAggre(mi, qs.groups, qs.cond, qs.orders)
 		} else {
-			// Do something without content
-			cur, err = col.Aggregate(todo, aggre, opt)
+			paths := mi.fields.dbcols
+			if len(cols) > 0 {
+				paths = make([]string, 0, len(cols))
+				for _, col := range cols {
+					paths = append(paths, valuePath(mi, col))
+				}
+			}
+			pipeline = distinctPipeline(qs, cond, paths)
 		}
-		// defer cur.Close(todo)
-		if err != nil {
-			return
+		opt := options.Aggregate()
+		if qs.batchSize > 0 {
+			opt.SetBatchSize(qs.batchSize)
 		}
-		err = cur.All(todo, container)
-		return
+		return col.Aggregate(ctx, pipeline, opt)
 	}
 
 	opt := options.Find()
@@ -131,59 +227,260 @@ func (d *dbBaseMongo) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *
 		opt.SetSkip(qs.offset)
 	}
 
-	filter := convertCondition(cond)
-	if qs != nil && qs.forContext {
-		// Do something with content
-		cur, err = col.Find(qs.ctx, filter, opt)
+	if qs.batchSize > 0 {
+		opt.SetBatchSize(qs.batchSize)
+	}
+
+	filter := convertCondition(mi, cond)
+	return col.Find(ctx, filter, opt)
+}
+
+// rows iterator of mongodb.
+type mongoRows struct {
+	ctx context.Context
+	db  *DB
+	cur *mongo.Cursor
+}
+
+func (r *mongoRows) Next() bool {
+	return r.cur.Next(r.ctx)
+}
+
+// decode the current document into ptr.
+func (r *mongoRows) Scan(ptr interface{}) error {
+	return r.cur.Decode(ptr)
+}
+
+func (r *mongoRows) Err() error {
+	return r.db.txError(r.cur.Err())
+}
+
+func (r *mongoRows) Close() error {
+	return r.cur.Close(r.ctx)
+}
+
+// run the aggregation pipeline, decode the first document into container if one, else all of them.
+func (d *dbBaseMongo) Aggregate(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, pipeline []bson.D, container interface{}, one bool, tz *time.Location) (err error) {
+	db := q.(*DB)
+	col := d.collection(db, qs, mi)
+	ctx = db.sessionContext(ctx)
+
+	opt := options.Aggregate()
+	cur, err := col.Aggregate(ctx, pipeline, opt)
+	if err != nil {
+		return db.txError(err)
+	}
+	if !one {
+		err = cur.All(ctx, container)
+		return db.txError(err)
+	}
+
+	defer cur.Close(ctx)
+	if !cur.Next(ctx) {
+		if err = cur.Err(); err != nil {
+			return db.txError(err)
+		}
+		return ErrNoDocuments
+	}
+	return cur.Decode(container)
+}
+
+// query the aggregates of each group.
+func (d *dbBaseMongo) ReadAnnotates(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, anns []Annotation, results *[]Params, tz *time.Location) (int64, error) {
+	db := q.(*DB)
+	col := d.collection(db, qs, mi)
+	ctx = db.sessionContext(ctx)
+
+	opt := options.Aggregate()
+	cur, err := col.Aggregate(ctx, convertAnnotate(qs, cond, anns), opt)
+	if err != nil {
+		return 0, db.txError(err)
+	}
+	docs := []bson.M{}
+	if err = cur.All(ctx, &docs); err != nil {
+		return 0, db.txError(err)
+	}
+	res := d.annotateParams(qs, mi, anns, docs, tz)
+	*results = res
+	return int64(len(res)), nil
+}
+
+// convert the documents of ReadAnnotates to the results of clickhouse.
+func (d *dbBaseMongo) annotateParams(qs *querySet, mi *modelInfo, anns []Annotation, docs []bson.M, tz *time.Location) []Params {
+	// like sql, there's one row without GroupBy even if nothing matched
+	if len(docs) == 0 && len(qs.groups) == 0 {
+		doc := bson.M{}
+		for _, ann := range anns {
+			doc[ann.Name] = nil
+			if ann.Func == AggCount || ann.Func == AggCountDistinct {
+				doc[ann.Name] = int32(0)
+			}
+		}
+		docs = append(docs, doc)
+	}
+
+	// the groups, min and max keep the type of the field, like clickhouse
+	fields := make(map[string]*fieldInfo, len(qs.groups)+len(anns))
+	for _, group := range qs.groups {
+		fields[group], _ = mi.fields.GetByAny(group)
+	}
+	for _, ann := range anns {
+		if ann.Func == AggMin || ann.Func == AggMax {
+			fields[ann.Name], _ = mi.fields.GetByAny(ann.Field)
+		}
+	}
+
+	res := make([]Params, 0, len(docs))
+	for _, doc := range docs {
+		for name, fi := range fields {
+			val := doc[name]
+			if t, ok := val.(primitive.DateTime); ok {
+				val = t.Time().In(tz)
+			}
+			if fi != nil {
+				value, err := d.convertValueFromDB(fi, val, tz)
+				if err != nil {
+					panic(fmt.Errorf("db value convert failed `%v` %s", val, err.Error()))
+				}
+				val = value
+			}
+			doc[name] = val
+		}
+		res = append(res, Params(doc))
+	}
+	return res
+}
+
+// query values of the exprs, save to *[]Params, *[]ParamsList or *ParamsList.
+// exprs of nested fields use __, e.g. address__city, all model fields are read without exprs.
+func (d *dbBaseMongo) ReadValues(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, exprs []string, container interface{}, tz *time.Location) (int64, error) {
+	switch container.(type) {
+	case *[]Params, *[]ParamsList, *ParamsList:
+	default:
+		panic(fmt.Errorf("unsupport read values type `%T`", container))
+	}
+
+	var names, paths []string
+	if len(exprs) > 0 {
+		names = exprs
+		paths = make([]string, 0, len(exprs))
+		for _, ex := range exprs {
+			paths = append(paths, valuePath(mi, ex))
+		}
+	} else {
+		names = make([]string, 0, len(mi.fields.fieldsDB))
+		paths = make([]string, 0, len(mi.fields.fieldsDB))
+		for _, fi := range mi.fields.fieldsDB {
+			names = append(names, fi.name)
+			paths = append(paths, fi.column)
+		}
+	}
+
+	db := q.(*DB)
+	col := d.collection(db, qs, mi)
+	ctx = db.sessionContext(ctx)
+
+	var (
+		cur *mongo.Cursor
+		err error
+	)
+	if qs.distinct {
+		cur, err = col.Aggregate(ctx, distinctPipeline(qs, cond, paths), options.Aggregate())
 	} else {
-		// Do something without content
-		cur, err = col.Find(todo, filter, opt)
+		opt := options.Find()
+		projection := bson.M{"_id": 0}
+		for _, path := range paths {
+			projection[path] = 1
+		}
+		opt.SetProjection(projection)
+
+		if len(qs.orders) > 0 {
+			opt.SetSort(getSort(qs.orders))
+		}
+		if qs.limit > 0 {
+			opt.SetLimit(qs.limit)
+		}
+		if qs.offset > 0 {
+			opt.SetSkip(qs.offset)
+		}
+
+		filter := convertCondition(mi, cond)
+		cur, err = col.Find(ctx, filter, opt)
 	}
-	// defer cur.Close(todo)
 	if err != nil {
-		return
+		return 0, db.txError(err)
+	}
+	docs := []bson.M{}
+	if err = cur.All(ctx, &docs); err != nil {
+		return 0, db.txError(err)
 	}
 
-	err = cur.All(todo, container)
+	var (
+		maps  = make([]Params, 0, len(docs))
+		lists = make([]ParamsList, 0, len(docs))
+		list  = make(ParamsList, 0, len(docs))
+	)
+	for _, doc := range docs {
+		switch container.(type) {
+		case *[]Params:
+			params := make(Params, len(paths))
+			for i, path := range paths {
+				params[names[i]] = lookupValue(doc, path, tz)
+			}
+			maps = append(maps, params)
+		case *[]ParamsList:
+			params := make(ParamsList, 0, len(paths))
+			for _, path := range paths {
+				params = append(params, lookupValue(doc, path, tz))
+			}
+			lists = append(lists, params)
+		case *ParamsList:
+			for _, path := range paths {
+				list = append(list, lookupValue(doc, path, tz))
+			}
+		}
+	}
 
-	return
+	switch v := container.(type) {
+	case *[]Params:
+		*v = maps
+	case *[]ParamsList:
+		*v = lists
+	case *ParamsList:
+		*v = list
+	}
+	return int64(len(docs)), nil
 }
 
 // get the recodes count.
-func (d *dbBaseMongo) Count(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (i int64, err error) {
-	db := qs.orm.db.(*DB).MDB
-	col := db.Collection(mi.table)
+func (d *dbBaseMongo) Count(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (i int64, err error) {
+	db := q.(*DB)
+	col := d.collection(db, qs, mi)
+	ctx = db.sessionContext(ctx)
 
 	opt := options.Count()
 
-	filter := convertCondition(cond)
+	filter := convertCondition(mi, cond)
 
-	if qs != nil && qs.forContext {
-		if len(filter) == 0 {
-			i, err = col.EstimatedDocumentCount(qs.ctx, nil)
-		} else {
-			i, err = col.CountDocuments(qs.ctx, filter, opt)
-		}
+	// estimatedDocumentCount is not allowed in a transaction
+	if len(filter) == 0 && !db.isTx {
+		i, err = col.EstimatedDocumentCount(ctx, nil)
 	} else {
-		// Do something without content
-		if len(filter) == 0 {
-			i, err = col.EstimatedDocumentCount(todo, nil)
-		} else {
-			i, err = col.CountDocuments(todo, filter, opt)
-		}
+		i, err = col.CountDocuments(ctx, filter, opt)
 	}
 
-	return
+	return i, db.txError(err)
 }
 
 // update the recodes.
-func (d *dbBaseMongo) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, operator OperatorUpdate, params Params, tz *time.Location) (i int64, err error) {
-	db := qs.orm.db.(*DB).MDB
-	col := db.Collection(mi.table)
+func (d *dbBaseMongo) UpdateBatch(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, operator OperatorUpdate, params Params, tz *time.Location) (i int64, err error) {
+	db := q.(*DB)
+	col := d.collection(db, qs, mi)
+	ctx = db.sessionContext(ctx)
 
 	opt := options.Update()
 
-	filter := convertCondition(cond)
+	filter := convertCondition(mi, cond)
 	update := bson.M{}
 	for col, val := range params {
 		// if fi, ok := mi.fields.GetByAny(col); !ok || !fi.dbcol {
@@ -195,15 +492,9 @@ func (d *dbBaseMongo) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond
 	update = bson.M{
 		string(operator): update,
 	}
-	r := &mongo.UpdateResult{}
-	if qs != nil && qs.forContext {
-		r, err = col.UpdateMany(qs.ctx, filter, update, opt)
-	} else {
-		// Do something without content
-		r, err = col.UpdateMany(todo, filter, update, opt)
-	}
+	r, err := col.UpdateMany(ctx, filter, update, opt)
 	if err != nil {
-		return
+		return 0, db.txError(err)
 	}
 
 	i = r.ModifiedCount
@@ -212,23 +503,18 @@ func (d *dbBaseMongo) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond
 }
 
 // delete the recodes.
-func (d *dbBaseMongo) DeleteBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (i int64, err error) {
-	db := qs.orm.db.(*DB).MDB
-	col := db.Collection(mi.table)
+func (d *dbBaseMongo) DeleteBatch(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (i int64, err error) {
+	db := q.(*DB)
+	col := d.collection(db, qs, mi)
+	ctx = db.sessionContext(ctx)
 
 	opt := options.Delete()
 
-	filter := convertCondition(cond)
+	filter := convertCondition(mi, cond)
 
-	r := &mongo.DeleteResult{}
-	if qs != nil && qs.forContext {
-		r, err = col.DeleteMany(qs.ctx, filter, opt)
-	} else {
-		// Do something without content
-		r, err = col.DeleteMany(todo, filter, opt)
-	}
+	r, err := col.DeleteMany(ctx, filter, opt)
 	if err != nil {
-		return
+		return 0, db.txError(err)
 	}
 
 	i = r.DeletedCount
@@ -237,9 +523,10 @@ func (d *dbBaseMongo) DeleteBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond
 }
 
 // read one record.
-func (d *dbBaseMongo) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, container interface{}, tz *time.Location, cols []string, isForUpdate bool) (err error) {
-	db := q.(*DB).MDB
-	col := db.Collection(mi.table)
+func (d *dbBaseMongo) Read(ctx context.Context, q dbQuerier, mi *modelInfo, ind reflect.Value, container interface{}, tz *time.Location, cols []string, isForUpdate bool) (err error) {
+	db := q.(*DB)
+	col := d.collection(db, nil, mi)
+	ctx = db.sessionContext(ctx)
 
 	opt := options.FindOne()
 
@@ -265,10 +552,9 @@ func (d *dbBaseMongo) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, contai
 	for i, p := range whereCols {
 		filter[p] = args[i]
 	}
-	// Do something without content
-	data, err := col.FindOne(todo, filter, opt).DecodeBytes()
+	data, err := col.FindOne(ctx, filter, opt).DecodeBytes()
 	if err != nil {
-		return err
+		return db.txError(err)
 	}
 	err = bson.Unmarshal(data, container)
 
@@ -276,9 +562,10 @@ func (d *dbBaseMongo) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, contai
 }
 
 // insert one record.
-func (d *dbBaseMongo) InsertOne(q dbQuerier, mi *modelInfo, ind reflect.Value, container interface{}, tz *time.Location) (id interface{}, err error) {
-	db := q.(*DB).MDB
-	col := db.Collection(mi.table)
+func (d *dbBaseMongo) InsertOne(ctx context.Context, q dbQuerier, mi *modelInfo, ind reflect.Value, container interface{}, tz *time.Location) (id interface{}, err error) {
+	db := q.(*DB)
+	col := d.collection(db, nil, mi)
+	ctx = db.sessionContext(ctx)
 	_, _, b := getExistPk(mi, ind)
 	name := mi.fields.pk.name
 
@@ -288,19 +575,19 @@ func (d *dbBaseMongo) InsertOne(q dbQuerier, mi *modelInfo, ind reflect.Value, c
 
 	opt := options.InsertOne()
 
-	// Do something without content
-	data, err := col.InsertOne(todo, container, opt)
+	data, err := col.InsertOne(ctx, container, opt)
 	if err != nil {
-		return
+		return nil, db.txError(err)
 	}
 	id = data.InsertedID
 	return
 }
 
 // insert all records.
-func (d *dbBaseMongo) InsertMulti(q dbQuerier, mi *modelInfo, sind reflect.Value, bulk int, containers interface{}, tz *time.Location) (ids interface{}, err error) {
-	db := q.(*DB).MDB
-	col := db.Collection(mi.table)
+func (d *dbBaseMongo) InsertMulti(ctx context.Context, q dbQuerier, mi *modelInfo, sind reflect.Value, bulk int, containers interface{}, tz *time.Location) (ids interface{}, err error) {
+	db := q.(*DB)
+	col := d.collection(db, nil, mi)
+	ctx = db.sessionContext(ctx)
 	ind := reflect.Indirect(sind.Index(0))
 	_, _, b := getExistPk(mi, ind)
 	name := mi.fields.pk.name
@@ -321,19 +608,19 @@ func (d *dbBaseMongo) InsertMulti(q dbQuerier, mi *modelInfo, sind reflect.Value
 
 	opt := options.InsertMany()
 
-	// Do something without content
-	data, err := col.InsertMany(todo, cs, opt)
+	data, err := col.InsertMany(ctx, cs, opt)
 	if err != nil {
-		return
+		return nil, db.txError(err)
 	}
 	ids = data.InsertedIDs
 	return
 }
 
 // update one record.
-func (d *dbBaseMongo) Update(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string) (id interface{}, err error) {
-	db := q.(*DB).MDB
-	col := db.Collection(mi.table)
+func (d *dbBaseMongo) Update(ctx context.Context, q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string) (id interface{}, err error) {
+	db := q.(*DB)
+	col := d.collection(db, nil, mi)
+	ctx = db.sessionContext(ctx)
 	c, val, b := getExistPk(mi, ind)
 	if !b {
 		return nil, ErrHaveNoPK
@@ -367,10 +654,9 @@ func (d *dbBaseMongo) Update(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *
 		"$set": update,
 	}
 
-	// Do something without content
-	data, err := col.UpdateOne(todo, filter, update, opt)
+	data, err := col.UpdateOne(ctx, filter, update, opt)
 	if err != nil {
-		return
+		return nil, db.txError(err)
 	}
 	if data.MatchedCount <= 0 {
 		err = ErrNoDocuments
@@ -381,9 +667,10 @@ func (d *dbBaseMongo) Update(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *
 }
 
 // delete one record.
-func (d *dbBaseMongo) Delete(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string) (cnt interface{}, err error) {
-	db := q.(*DB).MDB
-	col := db.Collection(mi.table)
+func (d *dbBaseMongo) Delete(ctx context.Context, q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Location, cols []string) (cnt interface{}, err error) {
+	db := q.(*DB)
+	col := d.collection(db, nil, mi)
+	ctx = db.sessionContext(ctx)
 
 	opt := options.Delete()
 	var whereCols []string
@@ -409,123 +696,618 @@ func (d *dbBaseMongo) Delete(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *
 		filter[p] = args[i]
 	}
 
-	// Do something without content
-	data, err := col.DeleteOne(todo, filter, opt)
+	data, err := col.DeleteOne(ctx, filter, opt)
+	if err != nil {
+		return nil, db.txError(err)
+	}
 	cnt = data.DeletedCount
 	return
 }
 
+// get the collection of mi with the read options of qs and the write concern of db.
+// options are not allowed inside a transaction, the ones of the transaction are used.
+func (d *dbBaseMongo) collection(db *DB, qs *querySet, mi *modelInfo) *mongo.Collection {
+	if db.isTx {
+		return db.MDB.Collection(mi.table)
+	}
+	opts := options.Collection()
+	if db.writeConcern != nil {
+		opts.SetWriteConcern(db.writeConcern)
+	}
+	if qs != nil {
+		if qs.readPref != nil {
+			opts.SetReadPreference(qs.readPref)
+		}
+		if qs.readConcern != nil {
+			opts.SetReadConcern(qs.readConcern)
+		}
+	}
+	return db.MDB.Collection(mi.table, opts)
+}
+
+// create the collection of the model with the optional validator, and build the indexes declared by it.
+func (d *dbBaseMongo) SyncTable(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, opts SyncOptions) (err error) {
+	db := q.(*DB)
+	plan := func(format string, args ...interface{}) {
+		if opts.Verbose || opts.DryRun {
+			fmt.Printf(format+"\n", args...)
+		}
+	}
+
+	if opts.Force {
+		plan("drop collection `%s`", mi.table)
+		if !opts.DryRun {
+			if err = db.MDB.Collection(mi.table).Drop(ctx); err != nil {
+				return
+			}
+		}
+	}
+	names, err := db.MDB.ListCollectionNames(ctx, bson.M{"name": mi.table})
+	if err != nil {
+		return
+	}
+
+	var validator bson.M
+	desc := ""
+	if opts.Validator {
+		validator = bson.M{"$jsonSchema": jsonSchema(mi)}
+		data, _ := bson.MarshalExtJSON(validator, false, false)
+		desc = " with validator " + string(data)
+	}
+	// the dropped collection is still there in dry run
+	switch {
+	case len(names) == 0 || opts.Force:
+		plan("create collection `%s`%s", mi.table, desc)
+		if !opts.DryRun {
+			copts := options.CreateCollection()
+			if validator != nil {
+				copts.SetValidator(validator)
+			}
+			err = db.MDB.CreateCollection(ctx, mi.table, copts)
+		}
+	case validator != nil:
+		plan("set collection `%s`%s", mi.table, desc)
+		if !opts.DryRun {
+			err = db.MDB.RunCommand(ctx, bson.D{{Key: "collMod", Value: mi.table}, {Key: "validator", Value: validator}}).Err()
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	indexes := modelIndexes(mi)
+	for _, index := range indexes {
+		desc = ""
+		if index.Unique != nil && *index.Unique {
+			desc += " unique"
+		}
+		if index.ExpireAfterSeconds != nil {
+			desc += fmt.Sprintf(" expireAfterSeconds(%d)", *index.ExpireAfterSeconds)
+		}
+		plan("create index of `%s` on %v%s", mi.table, index.Keys, desc)
+	}
+	if opts.DryRun || len(indexes) == 0 {
+		return
+	}
+	// SyncDB already holds the lease of db, the index view would take another one.
+	_, err = newIndexView(qs.orm, mi.table).(*indexView).createMany(ctx, db, indexes)
+	return
+}
+
+// get the indexes declared by the index, unique and ttl tags and the TableIndex and TableUnique methods.
+func modelIndexes(mi *modelInfo) []Index {
+	indexes := []Index{}
+	for _, fi := range mi.fields.fieldsDB {
+		if fi.pk || !fi.index && !fi.unique && fi.ttl == 0 {
+			continue
+		}
+		index := Index{Keys: []string{fi.column}}
+		if fi.unique {
+			index.SetUnique(true)
+		}
+		if fi.ttl > 0 {
+			index.SetExpireAfterSeconds(int32(fi.ttl / time.Second))
+		}
+		indexes = append(indexes, index)
+	}
+
+	keys := func(exprs []string) []string {
+		res := make([]string, len(exprs))
+		for i, expr := range exprs {
+			if expr[0] == '-' {
+				res[i] = "-" + valuePath(mi, expr[1:])
+			} else {
+				res[i] = valuePath(mi, expr)
+			}
+		}
+		return res
+	}
+	for _, exprs := range getTableIndex(mi.addrField) {
+		indexes = append(indexes, Index{Keys: keys(exprs)})
+	}
+	for _, exprs := range getTableUnique(mi.addrField) {
+		index := Index{Keys: keys(exprs)}
+		index.SetUnique(true)
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// get the $jsonSchema of the model, the fields are required unless null or omitempty.
+func jsonSchema(mi *modelInfo) bson.M {
+	properties := bson.M{}
+	required := bson.A{}
+	for _, fi := range mi.fields.fieldsDB {
+		// the fields of embedded structs are not top level in the documents
+		if len(fi.fieldIndex) > 1 || fi.sf.Type == nil {
+			continue
+		}
+		types := bsonTypes(fi.sf.Type)
+		if len(types) == 0 {
+			continue
+		}
+		tag, _ := bsoncodec.DefaultStructTagParser.ParseStructTags(fi.sf)
+		if fi.null || tag.OmitEmpty {
+			types = append(types, "null")
+		} else {
+			required = append(required, fi.column)
+		}
+		property := bson.M{"bsonType": types}
+		if fi.description != "" {
+			property["description"] = fi.description
+		}
+		properties[fi.column] = property
+	}
+
+	schema := bson.M{"bsonType": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// get the bson types the go type is encoded to, it's empty if the type is not checked.
+func bsonTypes(typ reflect.Type) bson.A {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(primitive.DateTime(0)):
+		return bson.A{"date"}
+	case reflect.TypeOf(primitive.ObjectID{}):
+		return bson.A{"objectId"}
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return bson.A{"bool"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return bson.A{"int", "long"}
+	case reflect.Float32, reflect.Float64:
+		return bson.A{"double"}
+	case reflect.String:
+		return bson.A{"string"}
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return bson.A{"binData"}
+		}
+		return bson.A{"array"}
+	case reflect.Struct, reflect.Map:
+		return bson.A{"object"}
+	}
+	return nil
+}
+
 // get indexview.
 func (d *dbBaseMongo) Indexes(qs *querySet, mi *modelInfo, tz *time.Location) (iv IndexViewer) {
-	db := qs.orm.db.(*DB).MDB
-	col := db.Collection(mi.table)
-
-	return newIndexView(col.Indexes())
+	return newIndexView(qs.orm, mi.table)
 }
 
-func convertCondition(cond *Condition) (filter bson.M) {
+// convert cond to a mongodb filter. like sql, AND binds tighter than OR,
+// so the terms are split into AND groups by OR, and NOT uses $not for an
+// expression and $nor for a sub condition. mi is used to tell the mongodb only
+// operators from the keys of a document, it can be nil.
+func convertCondition(mi *modelInfo, cond *Condition) (filter bson.M) {
 	filter = bson.M{}
-	if cond == nil {
+	if cond == nil || len(cond.params) == 0 {
 		return
 	}
+
+	groups := [][]bson.M{{}}
 	for i, p := range cond.params {
-		if p.isCond {
-			f := convertCondition(p.cond)
-			if i > 0 {
-				if p.isOr {
-					filter = bson.M{
-						"$or": bson.A{filter, f},
-					}
-				} else {
-					// where += "AND "
-					filter = bson.M{
-						"$and": bson.A{filter, f},
-					}
-				}
-			} else {
-				filter = f
-			}
+		if i > 0 && p.isOr {
+			groups = append(groups, []bson.M{})
+		}
+		last := len(groups) - 1
+		groups[last] = append(groups[last], convertCondValue(mi, p))
+	}
 
-		} else {
-			exprs := p.exprs
+	if len(groups) == 1 {
+		return andFilter(groups[0])
+	}
+	ors := make(bson.A, 0, len(groups))
+	for _, group := range groups {
+		ors = append(ors, andFilter(group))
+	}
+	return bson.M{"$or": ors}
+}
 
-			num := len(exprs) - 1
-			operator := ""
-			if operators[exprs[num]] {
-				operator = exprs[num]
-				exprs = exprs[:num]
-			}
+// convert one term of a condition.
+func convertCondValue(mi *modelInfo, p condValue) bson.M {
+	if p.filter != nil {
+		if p.isNot {
+			return bson.M{"$nor": bson.A{p.filter}}
+		}
+		return p.filter
+	}
+	if p.isCond {
+		f := convertCondition(mi, p.cond)
+		if p.isNot {
+			return bson.M{"$nor": bson.A{f}}
+		}
+		return f
+	}
 
-			if operator == "" {
-				operator = "eq"
-			}
+	exprs := p.exprs
+	num := len(exprs) - 1
+	operator := ""
+	if num > 0 && operators[exprs[num]] && (!mongoOnlyOperators[exprs[num]] || isOperand(mi, exprs[:num])) {
+		operator = exprs[num]
+		exprs = exprs[:num]
+	}
 
-			k, v := getCond(exprs, p.args, operator)
-
-			if i > 0 {
-				if p.isOr {
-					filter = bson.M{
-						"$or": bson.A{filter, bson.M{k: v}},
-					}
-				} else {
-					if _, ok := filter[k]; ok {
-						filter = bson.M{
-							"$and": bson.A{filter, bson.M{k: v}},
-						}
-					} else {
-						filter[k] = v
-					}
-				}
-			} else {
-				if _, ok := filter[k]; ok {
-					filter = bson.M{
-						"$and": bson.A{filter, bson.M{k: v}},
-					}
-				} else {
-					filter[k] = v
-				}
-			}
+	if operator == "" {
+		operator = "eq"
+	}
+
+	// $expr, $text and $where apply to the document, they have no field, e.g. "__text"
+	if len(exprs) == 1 && exprs[0] == "" {
+		if p.isNot && operator == "text" {
+			panic(fmt.Errorf("operator `text` cannot be negated, mongodb does not allow $text in $nor"))
+		}
+		f := getTopCond(p.args, operator)
+		if p.isNot {
+			return bson.M{"$nor": bson.A{f}}
+		}
+		return f
+	}
+
+	k, v := getCond(exprs, p.args, operator)
+	if p.isNot {
+		return bson.M{k: bson.M{"$not": v}}
+	}
+	return bson.M{k: v}
+}
 
+// check the path before a mongodb only operator is a field of the model, not a document,
+// e.g. "tags__size" is the $size of the array tags, while "meta__type" is the key type of
+// the map or struct meta. a path not found in the model is a key of a document too,
+// without the model the suffix is always the operator.
+func isOperand(mi *modelInfo, path []string) bool {
+	if mi == nil || len(path) == 1 && path[0] == "" {
+		return true
+	}
+	fi, ok := mi.fields.GetByAny(path[0])
+	if !ok {
+		return false
+	}
+	typ := fi.sf.Type
+	for _, name := range path[1:] {
+		if typ, ok = subFieldType(typ, name); !ok {
+			return false
 		}
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Map:
+		return false
+	case reflect.Struct:
+		return typ == reflect.TypeOf(time.Time{})
+	}
+	return true
+}
 
+// get the type of the field name of a struct, or of the struct elements of a slice.
+// name is the bson name of the field.
+func subFieldType(typ reflect.Type, name string) (reflect.Type, bool) {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, false
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		key := strings.Split(sf.Tag.Get("bson"), ",")[0]
+		if key == "" {
+			key = strings.ToLower(sf.Name)
+		}
+		if key == name {
+			return sf.Type, true
+		}
+	}
+	return nil, false
+}
+
+// get a filter of the top level operators expr, text and where.
+func getTopCond(args []interface{}, operator string) bson.M {
+	if len(args) != 1 {
+		panic(fmt.Errorf("operator `%s` need 1 args not %d", operator, len(args)))
+	}
+	arg := args[0]
+	switch operator {
+	case "expr":
+		return bson.M{"$expr": arg}
+	case "text":
+		// a string is the $search of $text, a document is used as it is
+		if search, ok := arg.(string); ok {
+			return bson.M{"$text": bson.M{"$search": search}}
+		}
+		return bson.M{"$text": arg}
+	case "where":
+		return bson.M{"$where": arg}
+	}
+	panic(fmt.Errorf("operator `%s` need a field name", operator))
+}
+
+// join terms with AND, they are merged into one document when no key repeats,
+// otherwise $and keeps every term.
+func andFilter(terms []bson.M) (filter bson.M) {
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	filter = bson.M{}
+	for _, term := range terms {
+		for k, v := range term {
+			if _, ok := filter[k]; ok {
+				and := make(bson.A, 0, len(terms))
+				for _, t := range terms {
+					and = append(and, t)
+				}
+				return bson.M{"$and": and}
+			}
+			filter[k] = v
+		}
 	}
 	return
 }
 
+// get the filter of a field, the lookups are translated into mongodb operators
+// the same way as sql: like lookups become escaped $regex, isnull checks null or missing.
 func getCond(params []string, args []interface{}, operator string) (k string, v bson.M) {
 	k = strings.Join(params, ".")
 	if len(args) == 0 {
-		v = bson.M{}
-	} else if len(args) == 1 {
+		return k, bson.M{}
+	}
+	arg := args[0]
+
+	switch operator {
+	case "exact":
+		operator = "eq"
+	case "nq":
+		operator = "ne"
+	case "iexact", "contains", "icontains", "startswith", "istartswith", "endswith", "iendswith":
+		pattern := regexp.QuoteMeta(ToStr(arg))
+		switch operator {
+		case "iexact":
+			pattern = "^" + pattern + "$"
+		case "startswith", "istartswith":
+			pattern = "^" + pattern
+		case "endswith", "iendswith":
+			pattern = pattern + "$"
+		}
+		v = bson.M{"$regex": pattern}
+		if operator[0] == 'i' {
+			v["$options"] = "i"
+		}
+		return
+	case "regex", "iregex":
+		v = bson.M{"$regex": ToStr(arg)}
+		if operator == "iregex" {
+			v["$options"] = "i"
+		}
+		return
+	case "isnull":
+		b, ok := arg.(bool)
+		if !ok {
+			panic(fmt.Errorf("operator `%s` need a bool value not `%T`", operator, arg))
+		}
+		if b {
+			return k, bson.M{"$eq": nil}
+		}
+		return k, bson.M{"$ne": nil}
+	case "between":
+		vals := args
+		if len(args) == 1 {
+			vals = toSlice(arg)
+		}
+		if len(vals) != 2 {
+			panic(fmt.Errorf("operator `%s` need 2 args not %d", operator, len(vals)))
+		}
+		return k, bson.M{"$gte": vals[0], "$lte": vals[1]}
+	case "in", "nin":
+		// one scalar is a list of one value, the same as IN (?) of clickhouse
+		vals := args
+		if len(args) == 1 {
+			vals = toSlice(arg)
+		}
+		return k, bson.M{"$" + operator: vals}
+	}
+
+	op := "$" + operator
+	if name, ok := mongoOperators[operator]; ok {
+		op = name
+	}
+	if len(args) == 1 {
 		v = bson.M{
-			"$" + operator: args[0],
+			op: arg,
 		}
 	} else {
 		v = bson.M{
-			"$" + operator: args,
+			op: args,
 		}
 	}
+	return
+}
+
+// get the elements of a slice or array, other values are returned alone.
+func toSlice(arg interface{}) []interface{} {
+	val := reflect.ValueOf(arg)
+	if _, ok := arg.(primitive.ObjectID); ok || val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return []interface{}{arg}
+	}
+	vals := make([]interface{}, val.Len())
+	for i := range vals {
+		vals[i] = val.Index(i).Interface()
+	}
+	return vals
+}
+
+// convert the annotations to a pipeline, the group fields and annotations are
+// projected to the top level, so the orders can use both of them.
+func convertAnnotate(qs *querySet, cond *Condition, anns []Annotation) (pipeline []bson.D) {
+	if filter := convertCondition(qs.mi, cond); len(filter) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	}
 
-	if operator == "regex" {
-		v["$options"] = "i"
+	var id interface{}
+	project := bson.M{"_id": 0}
+	if len(qs.groups) > 0 {
+		ids := bson.M{}
+		for _, group := range qs.groups {
+			ids[group] = fieldPath(group)
+			project[group] = "$_id." + group
+		}
+		id = ids
+	}
+
+	group := bson.M{"_id": id}
+	for _, ann := range anns {
+		path := fieldPath(ann.Field)
+		project[ann.Name] = 1
+		switch ann.Func {
+		case AggSum, AggAvg, AggMin, AggMax:
+			group[ann.Name] = bson.M{"$" + string(ann.Func): path}
+		case AggCount:
+			if ann.Field == "" {
+				group[ann.Name] = bson.M{"$sum": 1}
+			} else {
+				// like sql, null values are not counted
+				group[ann.Name] = bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{path, nil}}, 1, 0}}}
+			}
+		case AggCountDistinct:
+			group[ann.Name] = bson.M{"$addToSet": path}
+			project[ann.Name] = bson.M{"$size": "$" + ann.Name}
+		default:
+			panic(fmt.Errorf("unknown aggregate function `%s`", ann.Func))
+		}
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: group}},
+		bson.D{{Key: "$project", Value: project}},
+	)
+
+	if len(qs.orders) > 0 {
+		// the projected keys are the exprs themselves, not dotted paths
+		sort := bson.D{}
+		for _, order := range qs.orders {
+			if order[0] == '-' {
+				sort = append(sort, bson.E{Key: order[1:], Value: -1})
+			} else {
+				sort = append(sort, bson.E{Key: order, Value: 1})
+			}
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+	}
+	if qs.offset > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: qs.offset}})
+	}
+	if qs.limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: qs.limit}})
 	}
 	return
 }
 
-func getSort(orders []string) (r bson.M) {
-	r = bson.M{}
-	if len(orders) == 0 {
-		return
+// get the dotted field name of the expr, e.g. user.name for user__name.
+func fieldName(expr string) string {
+	return strings.Replace(expr, ExprSep, ".", -1)
+}
+
+// get the field path of the expr, e.g. $user.name for user__name.
+func fieldPath(expr string) string {
+	return "$" + fieldName(expr)
+}
+
+// get the pipeline of the distinct rows of paths, like SELECT DISTINCT.
+// the rows are grouped by the values of paths and projected back to the paths,
+// so they keep the structure of the documents.
+func distinctPipeline(qs *querySet, cond *Condition, paths []string) (pipeline []bson.D) {
+	if filter := convertCondition(qs.mi, cond); len(filter) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
 	}
+
+	ids := bson.M{}
+	project := bson.M{"_id": 0}
+	for i, path := range paths {
+		// the keys of an expression object can not contain dots
+		key := "f" + strconv.Itoa(i)
+		ids[key] = "$" + path
+		project[path] = "$_id." + key
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.M{"_id": ids}}},
+		bson.D{{Key: "$project", Value: project}},
+	)
+
+	if len(qs.orders) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: getSort(qs.orders)}})
+	}
+	if qs.offset > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: qs.offset}})
+	}
+	if qs.limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: qs.limit}})
+	}
+	return
+}
+
+// get the dotted path of a values expr, the first name can be the model field name or the column.
+func valuePath(mi *modelInfo, expr string) string {
+	names := strings.Split(expr, ExprSep)
+	if fi, ok := mi.fields.GetByAny(names[0]); ok {
+		names[0] = fi.column
+	}
+	return strings.Join(names, ".")
+}
+
+// get the value of the dotted path in doc, nil when missing. datetime is converted to time in tz.
+func lookupValue(doc bson.M, path string, tz *time.Location) interface{} {
+	var val interface{} = doc
+	for _, name := range strings.Split(path, ".") {
+		m, ok := val.(bson.M)
+		if !ok {
+			return nil
+		}
+		val = m[name]
+	}
+	if t, ok := val.(primitive.DateTime); ok {
+		return t.Time().In(tz)
+	}
+	return val
+}
+
+// get the sort document, it keeps the order of the fields.
+func getSort(orders []string) (r bson.D) {
+	r = bson.D{}
 	for _, order := range orders {
 		if order[0] == '-' {
-			order = order[1:]
-			r[order] = -1
+			r = append(r, bson.E{Key: fieldName(order[1:]), Value: -1})
 		} else {
-			r[order] = 1
+			r = append(r, bson.E{Key: fieldName(order), Value: 1})
 		}
 	}
-
 	return
 }
 func getGroup(groups []string) (r bson.M) {
@@ -575,8 +1357,8 @@ func getGroup(groups []string) (r bson.M) {
 	return
 }
 
-func convertAggre(groups []string, cond *Condition, orders []string) (aggre []bson.D) {
-	filter := convertCondition(cond)
+func convertAggre(mi *modelInfo, groups []string, cond *Condition, orders []string) (aggre []bson.D) {
+	filter := convertCondition(mi, cond)
 	sort := getSort(orders)
 	aggre = make([]bson.D, 0)
 
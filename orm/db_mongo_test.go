@@ -0,0 +1,553 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestConvertCondition(t *testing.T) {
+	sub := NewCondition().And("age__gt", 18).Or("vip", true)
+
+	cases := []struct {
+		name string
+		cond *Condition
+		want bson.M
+	}{
+		{
+			name: "nil",
+			cond: nil,
+			want: bson.M{},
+		},
+		{
+			name: "and",
+			cond: NewCondition().And("name", "a").And("age__gte", 18),
+			want: bson.M{"name": bson.M{"$eq": "a"}, "age": bson.M{"$gte": 18}},
+		},
+		{
+			name: "and same key",
+			cond: NewCondition().And("age__gte", 18).And("age__lt", 60),
+			want: bson.M{"$and": bson.A{
+				bson.M{"age": bson.M{"$gte": 18}},
+				bson.M{"age": bson.M{"$lt": 60}},
+			}},
+		},
+		{
+			name: "and not",
+			cond: NewCondition().And("name", "a").AndNot("age__in", 1, 2),
+			want: bson.M{
+				"name": bson.M{"$eq": "a"},
+				"age":  bson.M{"$not": bson.M{"$in": []interface{}{1, 2}}},
+			},
+		},
+		{
+			name: "in one value",
+			cond: NewCondition().And("age__in", 5).And("name__nin", []string{"a", "b"}),
+			want: bson.M{
+				"age":  bson.M{"$in": []interface{}{5}},
+				"name": bson.M{"$nin": []interface{}{"a", "b"}},
+			},
+		},
+		{
+			name: "and binds tighter than or",
+			cond: NewCondition().And("a", 1).And("b", 2).Or("c", 3).And("d", 4),
+			want: bson.M{"$or": bson.A{
+				bson.M{"a": bson.M{"$eq": 1}, "b": bson.M{"$eq": 2}},
+				bson.M{"c": bson.M{"$eq": 3}, "d": bson.M{"$eq": 4}},
+			}},
+		},
+		{
+			name: "or not",
+			cond: NewCondition().And("a", 1).OrNot("b", 2),
+			want: bson.M{"$or": bson.A{
+				bson.M{"a": bson.M{"$eq": 1}},
+				bson.M{"b": bson.M{"$not": bson.M{"$eq": 2}}},
+			}},
+		},
+		{
+			name: "and cond",
+			cond: NewCondition().And("name", "a").AndCond(sub),
+			want: bson.M{
+				"name": bson.M{"$eq": "a"},
+				"$or": bson.A{
+					bson.M{"age": bson.M{"$gt": 18}},
+					bson.M{"vip": bson.M{"$eq": true}},
+				},
+			},
+		},
+		{
+			name: "and not cond",
+			cond: NewCondition().And("name", "a").AndNotCond(sub),
+			want: bson.M{
+				"name": bson.M{"$eq": "a"},
+				"$nor": bson.A{bson.M{"$or": bson.A{
+					bson.M{"age": bson.M{"$gt": 18}},
+					bson.M{"vip": bson.M{"$eq": true}},
+				}}},
+			},
+		},
+		{
+			name: "or not cond",
+			cond: NewCondition().And("name", "a").OrNotCond(NewCondition().And("age", 1).And("vip", true)),
+			want: bson.M{"$or": bson.A{
+				bson.M{"name": bson.M{"$eq": "a"}},
+				bson.M{"$nor": bson.A{bson.M{"age": bson.M{"$eq": 1}, "vip": bson.M{"$eq": true}}}},
+			}},
+		},
+		{
+			name: "nested conds with the same operator",
+			cond: NewCondition().AndCond(sub).AndCond(NewCondition().And("x", 1).Or("y", 2)),
+			want: bson.M{"$and": bson.A{
+				bson.M{"$or": bson.A{
+					bson.M{"age": bson.M{"$gt": 18}},
+					bson.M{"vip": bson.M{"$eq": true}},
+				}},
+				bson.M{"$or": bson.A{
+					bson.M{"x": bson.M{"$eq": 1}},
+					bson.M{"y": bson.M{"$eq": 2}},
+				}},
+			}},
+		},
+		{
+			name: "array operators",
+			cond: NewCondition().And("tags__all", "a", "b").And("scores__elemmatch", bson.M{"$gt": 80}).And("items__size", 3),
+			want: bson.M{
+				"tags":   bson.M{"$all": []interface{}{"a", "b"}},
+				"scores": bson.M{"$elemMatch": bson.M{"$gt": 80}},
+				"items":  bson.M{"$size": 3},
+			},
+		},
+		{
+			name: "element and evaluation operators",
+			cond: NewCondition().And("email__exists", true).And("age__type", "int").And("qty__mod", 4, 0),
+			want: bson.M{
+				"email": bson.M{"$exists": true},
+				"age":   bson.M{"$type": "int"},
+				"qty":   bson.M{"$mod": []interface{}{4, 0}},
+			},
+		},
+		{
+			name: "top level operators",
+			cond: NewCondition().And("__text", "coffee").And("__expr", bson.M{"$gt": bson.A{"$spent", "$budget"}}),
+			want: bson.M{
+				"$text": bson.M{"$search": "coffee"},
+				"$expr": bson.M{"$gt": bson.A{"$spent", "$budget"}},
+			},
+		},
+		{
+			name: "not top level operator",
+			cond: NewCondition().AndNot("__where", "this.a > this.b"),
+			want: bson.M{"$nor": bson.A{bson.M{"$where": "this.a > this.b"}}},
+		},
+		{
+			name: "field named like an operator",
+			cond: NewCondition().And("type", "group").And("size__gt", 1),
+			want: bson.M{
+				"type": bson.M{"$eq": "group"},
+				"size": bson.M{"$gt": 1},
+			},
+		},
+		{
+			name: "raw bson",
+			cond: NewCondition().And("name", "a").RawBson(bson.M{"loc": bson.M{"$near": bson.A{1, 2}}}),
+			want: bson.M{
+				"name": bson.M{"$eq": "a"},
+				"loc":  bson.M{"$near": bson.A{1, 2}},
+			},
+		},
+		{
+			name: "like lookups",
+			cond: NewCondition().And("name__icontains", "a.b").And("code__startswith", "x*").And("mail__iendswith", "@a.com"),
+			want: bson.M{
+				"name": bson.M{"$regex": `a\.b`, "$options": "i"},
+				"code": bson.M{"$regex": `^x\*`},
+				"mail": bson.M{"$regex": `@a\.com$`, "$options": "i"},
+			},
+		},
+		{
+			name: "iexact and regex",
+			cond: NewCondition().And("name__iexact", "Tom").And("code__regex", "^a+").And("tag__iregex", "b$"),
+			want: bson.M{
+				"name": bson.M{"$regex": "^Tom$", "$options": "i"},
+				"code": bson.M{"$regex": "^a+"},
+				"tag":  bson.M{"$regex": "b$", "$options": "i"},
+			},
+		},
+		{
+			name: "isnull and between",
+			cond: NewCondition().And("email__isnull", true).And("phone__isnull", false).And("age__between", 18, 60),
+			want: bson.M{
+				"email": bson.M{"$eq": nil},
+				"phone": bson.M{"$ne": nil},
+				"age":   bson.M{"$gte": 18, "$lte": 60},
+			},
+		},
+		{
+			name: "between slice and exclude",
+			cond: NewCondition().AndNot("age__between", []int{18, 60}).And("name__nq", "a"),
+			want: bson.M{
+				"age":  bson.M{"$not": bson.M{"$gte": 18, "$lte": 60}},
+				"name": bson.M{"$ne": "a"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := convertCondition(nil, c.cond)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("convertCondition() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+type mongoShop struct {
+	Id      string                 `orm:"pk" bson:"_id"`
+	Tags    []string               `bson:"tags"`
+	Meta    map[string]interface{} `bson:"meta"`
+	Address *shopAddress           `bson:"address"`
+	Created time.Time              `bson:"created"`
+}
+
+type shopAddress struct {
+	Type  string   `bson:"type"`
+	Zones []string `bson:"zones"`
+}
+
+func TestMongoOnlyOperatorPath(t *testing.T) {
+	mi := newModelInfo(reflect.ValueOf(new(mongoShop)))
+
+	cases := []struct {
+		expr string
+		want bson.M
+	}{
+		{"tags__size", bson.M{"tags": bson.M{"$size": 2}}},
+		{"created__exists", bson.M{"created": bson.M{"$exists": 2}}},
+		{"meta__type", bson.M{"meta.type": bson.M{"$eq": 2}}},
+		{"meta__kind__exists", bson.M{"meta.kind.exists": bson.M{"$eq": 2}}},
+		{"address__type", bson.M{"address.type": bson.M{"$eq": 2}}},
+		{"address__type__type", bson.M{"address.type": bson.M{"$type": 2}}},
+		{"address__zones__size", bson.M{"address.zones": bson.M{"$size": 2}}},
+		{"address__zones__gt", bson.M{"address.zones": bson.M{"$gt": 2}}},
+		{"__where", bson.M{"$where": 2}},
+	}
+	for _, c := range cases {
+		if got := convertCondition(mi, NewCondition().And(c.expr, 2)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("convertCondition(%q) = %v, want %v", c.expr, got, c.want)
+		}
+	}
+
+	func() {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Error("convertCondition(AndNot(__text)) does not panic")
+			}
+		}()
+		convertCondition(mi, NewCondition().AndNot("__text", "foo"))
+	}()
+
+	// without the model the suffix is always the operator
+	if got, want := convertCondition(nil, NewCondition().And("meta__type", 2)), (bson.M{"meta": bson.M{"$type": 2}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("convertCondition(nil) = %v, want %v", got, want)
+	}
+}
+
+func TestPipelineStages(t *testing.T) {
+	qs := &querySet{cond: NewCondition().And("status", 1), orders: []string{"-created", "name"}, limit: 100}
+	base := newPipeline(qs).Unwind("items", false)
+	p := base.
+		Group("$name", AccSum("total", "$items.amount"), AccCount("count")).
+		Sort("-total").
+		Skip(10).
+		Limit(5)
+	facet := base.Facet(map[string]Pipeliner{
+		"top": NewPipeline().Limit(3),
+	})
+
+	want := []bson.D{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$eq": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created", Value: -1}, {Key: "name", Value: 1}}}},
+		{{Key: "$limit", Value: int64(100)}},
+		{{Key: "$unwind", Value: "$items"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$name",
+			"total": bson.M{"$sum": "$items.amount"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "total", Value: -1}}}},
+		{{Key: "$skip", Value: int64(10)}},
+		{{Key: "$limit", Value: int64(5)}},
+	}
+	if got := p.Stages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stages() = %v, want %v", got, want)
+	}
+
+	// the stages of base are not changed by the pipelines built from it
+	wantFacet := append(append([]bson.D{}, want[:4]...), bson.D{{Key: "$facet", Value: bson.M{
+		"top": []bson.D{{{Key: "$limit", Value: int64(3)}}},
+	}}})
+	if got := facet.Stages(); !reflect.DeepEqual(got, wantFacet) {
+		t.Errorf("Stages() = %v, want %v", got, wantFacet)
+	}
+
+	if err := NewPipeline().All(&[]bson.M{}); err != ErrNoQuerySet {
+		t.Errorf("All() error = %v, want %v", err, ErrNoQuerySet)
+	}
+}
+
+func TestConvertAnnotate(t *testing.T) {
+	qs := &querySet{groups: []string{"city", "shop__id"}, orders: []string{"-total", "shop__id"}, limit: 10}
+	cond := NewCondition().And("status", 1)
+	got := convertAnnotate(qs, cond, []Annotation{
+		{Name: "total", Func: AggSum, Field: "amount"},
+		{Name: "num", Func: AggCount},
+		{Name: "users", Func: AggCountDistinct, Field: "user__id"},
+	})
+
+	want := []bson.D{
+		{{Key: "$match", Value: bson.M{"status": bson.M{"$eq": 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"city": "$city", "shop__id": "$shop.id"},
+			"total": bson.M{"$sum": "$amount"},
+			"num":   bson.M{"$sum": 1},
+			"users": bson.M{"$addToSet": "$user.id"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":      0,
+			"city":     "$_id.city",
+			"shop__id": "$_id.shop__id",
+			"total":    1,
+			"num":      1,
+			"users":    bson.M{"$size": "$users"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "total", Value: -1}, {Key: "shop__id", Value: 1}}}},
+		{{Key: "$limit", Value: int64(10)}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("convertAnnotate() = %v, want %v", got, want)
+	}
+}
+
+func TestAnnotateParams(t *testing.T) {
+	mi := newModelInfo(reflect.ValueOf(new(mongoUser)))
+	d := newdbBaseMongo().(*dbBaseMongo)
+	tz := time.FixedZone("CST", 8*3600)
+	anns := []Annotation{
+		{Name: "oldest", Func: AggMin, Field: "created"},
+		{Name: "age", Func: AggMax, Field: "age"},
+		{Name: "total", Func: AggSum, Field: "age"},
+		{Name: "num", Func: AggCount},
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	got := d.annotateParams(&querySet{}, mi, anns, []bson.M{
+		{"oldest": primitive.NewDateTimeFromTime(now), "age": int32(30), "total": int32(60), "num": int32(2)},
+	}, tz)
+	want := []Params{{"oldest": now.In(tz), "age": int64(30), "total": int32(60), "num": int32(2)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("annotateParams() = %v, want %v", got, want)
+	}
+
+	// one row of nil aggregates and 0 counts when nothing matched
+	got = d.annotateParams(&querySet{}, mi, anns, []bson.M{}, tz)
+	want = []Params{{"oldest": nil, "age": nil, "total": nil, "num": int32(0)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("annotateParams() empty = %v, want %v", got, want)
+	}
+	if got = d.annotateParams(&querySet{groups: []string{"name"}}, mi, anns, []bson.M{}, tz); len(got) != 0 {
+		t.Errorf("annotateParams() empty groups = %v, want none", got)
+	}
+}
+
+func TestLookupValue(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	doc := bson.M{
+		"name":    "a",
+		"address": bson.M{"city": "hz", "geo": bson.M{"lat": 30.2}},
+		"created": primitive.NewDateTimeFromTime(now),
+		"tags":    bson.A{"x"},
+	}
+
+	cases := []struct {
+		path string
+		want interface{}
+	}{
+		{"name", "a"},
+		{"address.city", "hz"},
+		{"address.geo.lat", 30.2},
+		{"address.zip", nil},
+		{"tags.0", nil},
+		{"name.first", nil},
+		{"created", now.In(time.UTC)},
+	}
+	for _, c := range cases {
+		if got := lookupValue(doc, c.path, time.UTC); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("lookupValue(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestDistinctPipeline(t *testing.T) {
+	qs := &querySet{orders: []string{"address__city"}, limit: 5}
+	got := distinctPipeline(qs, NewCondition().And("age__gte", 18), []string{"name", "address.city"})
+
+	want := []bson.D{
+		{{Key: "$match", Value: bson.M{"age": bson.M{"$gte": 18}}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"f0": "$name", "f1": "$address.city"}}}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "name": "$_id.f0", "address.city": "$_id.f1"}}},
+		{{Key: "$sort", Value: bson.D{{Key: "address.city", Value: 1}}}},
+		{{Key: "$limit", Value: int64(5)}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("distinctPipeline() = %v, want %v", got, want)
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	orders := []string{"-time", "_id"}
+	values := []interface{}{100, "a"}
+
+	got := convertCondition(nil, keysetCondition(orders, values, false))
+	want := bson.M{"$or": bson.A{
+		bson.M{"time": bson.M{"$lt": 100}},
+		bson.M{"time": bson.M{"$eq": 100}, "_id": bson.M{"$gt": "a"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keysetCondition() = %v, want %v", got, want)
+	}
+
+	got = convertCondition(nil, keysetCondition(orders, values, true))
+	want = bson.M{"$or": bson.A{
+		bson.M{"time": bson.M{"$gt": 100}},
+		bson.M{"time": bson.M{"$eq": 100}, "_id": bson.M{"$lt": "a"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keysetCondition() backward = %v, want %v", got, want)
+	}
+}
+
+type mongoUser struct {
+	Id      string    `orm:"pk" bson:"_id"`
+	Name    string    `orm:"unique;description(user name)" bson:"name"`
+	Age     int       `orm:"index" bson:"age"`
+	Email   string    `orm:"null" bson:"email"`
+	Tags    []string  `bson:"tags,omitempty"`
+	Created time.Time `orm:"ttl(24h)" bson:"created"`
+}
+
+func (u *mongoUser) TableIndex() [][]string {
+	return [][]string{{"Age", "-created"}}
+}
+
+func TestModelIndexes(t *testing.T) {
+	mi := newModelInfo(reflect.ValueOf(new(mongoUser)))
+
+	got := modelIndexes(mi)
+	want := []Index{{Keys: []string{"name"}}, {Keys: []string{"age"}}, {Keys: []string{"created"}}, {Keys: []string{"age", "-created"}}}
+	want[0].SetUnique(true)
+	want[2].SetExpireAfterSeconds(86400)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("modelIndexes() = %v, want %v", got, want)
+	}
+
+	keys, _, _ := convertIndex(got[3])
+	if wantKeys := (bson.D{{Key: "age", Value: 1}, {Key: "created", Value: -1}}); !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("convertIndex() = %v, want %v", keys, wantKeys)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	mi := newModelInfo(reflect.ValueOf(new(mongoUser)))
+
+	got := jsonSchema(mi)
+	want := bson.M{
+		"bsonType": "object",
+		"properties": bson.M{
+			"_id":     bson.M{"bsonType": bson.A{"string"}},
+			"name":    bson.M{"bsonType": bson.A{"string"}, "description": "user name"},
+			"age":     bson.M{"bsonType": bson.A{"int", "long"}},
+			"email":   bson.M{"bsonType": bson.A{"string", "null"}},
+			"tags":    bson.M{"bsonType": bson.A{"array", "null"}},
+			"created": bson.M{"bsonType": bson.A{"date"}},
+		},
+		"required": bson.A{"_id", "name", "age", "created"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("jsonSchema() = %v, want %v", got, want)
+	}
+}
+
+func TestCommandMonitor(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(l *Log) { DebugLog = l }(DebugLog)
+	DebugLog = NewLog(&buf)
+
+	al := &alias{Name: "test_monitor"}
+	dataBaseCache.add(al.Name, al, true)
+	defer dataBaseCache.del(al.Name)
+
+	monitor := newCommandMonitor(al.Name)
+	run := func(id int64, failure string) {
+		cmd, _ := bson.Marshal(bson.D{{Key: "find", Value: "user"}})
+		monitor.Started(context.Background(), &event.CommandStartedEvent{Command: cmd, CommandName: "find", RequestID: id})
+		finished := event.CommandFinishedEvent{CommandName: "find", RequestID: id, Duration: time.Millisecond}
+		if failure == "" {
+			monitor.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: finished})
+		} else {
+			monitor.Failed(context.Background(), &event.CommandFailedEvent{CommandFinishedEvent: finished, Failure: failure})
+		}
+	}
+
+	run(1, "")
+	if buf.Len() != 0 {
+		t.Fatalf("logged without Debug: %s", buf.String())
+	}
+
+	al.Debug = true
+	run(2, "")
+	run(3, "unauthorized")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2: %s", len(lines), buf.String())
+	}
+	for i, want := range []string{"  OK", "FAIL"} {
+		if !strings.Contains(lines[i], "[Queries/test_monitor] - ["+want) || !strings.Contains(lines[i], `{"find": "user"}`) {
+			t.Errorf("line %d = %s", i, lines[i])
+		}
+	}
+	if !strings.Contains(lines[1], "unauthorized") {
+		t.Errorf("failure not logged: %s", lines[1])
+	}
+}
+
+func TestReplicaReadPref(t *testing.T) {
+	set := NewDataBaseOptions()
+	set.ReadPreference = readpref.Nearest()
+
+	cases := []struct {
+		name string
+		opts DataBaseOptions
+		uri  string
+		want *readpref.ReadPref
+	}{
+		{"replica set", NewDataBaseOptions(), "mongodb://r1:27017,r2:27017/test?replicaSet=rs0", readpref.SecondaryPreferred()},
+		{"set by options", set, "mongodb://r1:27017/test?replicaSet=rs0", nil},
+		{"set by uri", NewDataBaseOptions(), "mongodb://r1:27017/test?replicaSet=rs0&readPreference=secondary", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if rp := replicaReadPref(c.opts, c.uri); !reflect.DeepEqual(rp, c.want) {
+				t.Errorf("replicaReadPref() = %v, want %v", rp, c.want)
+			}
+		})
+	}
+}
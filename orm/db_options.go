@@ -0,0 +1,76 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/souliot/siot-orm/pool"
+
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// DataBaseOptions settings of a database alias, used by RegisterDataBaseWithOptions.
+// zero values are used as they are, start from NewDataBaseOptions to keep the defaults.
+type DataBaseOptions struct {
+	// connections opened at register and kept by the pool maintenance.
+	InitialCap int
+	// max connections of the pool.
+	MaxCap int
+	// idle connections above InitialCap older than it are closed, 0 keeps them.
+	IdleTimeout time.Duration
+	// connections older than it are not reused, 0 means unlimited.
+	MaxLifetime time.Duration
+	// how long an operation waits for a connection when MaxCap is reached, 0 waits until ctx is done.
+	WaitTimeout time.Duration
+	// interval of closing expired idle connections and refilling InitialCap, 0 disables it.
+	MaintainInterval time.Duration
+	// interval of pinging idle connections, 0 disables it.
+	HealthCheckInterval time.Duration
+	// timezone of the alias, nil uses DefaultTimeLoc.
+	TZ *time.Location
+	// column name strategy of raw queries, empty uses the one set by SetNameStrategy.
+	NameStrategy string
+	// default read preference of mongodb, nil uses the one of the uri.
+	ReadPreference *readpref.ReadPref
+	// default read concern of mongodb, nil uses the one of the uri.
+	ReadConcern *readconcern.ReadConcern
+	// default write concern of mongodb, nil uses the one of the uri.
+	WriteConcern *writeconcern.WriteConcern
+	// timeout of every operation whose context has no deadline, 0 means none.
+	// Rows and Iterate only use it to open the rows, reading them is not bounded.
+	QueryTimeout time.Duration
+	// log the queries of the alias to DebugLog, the commands of mongodb and the statements of clickhouse.
+	Debug bool
+	// data sources of the read replicas, the reads of QuerySeter go to them, each gets a pool of the same config.
+	// mongodb replicas must use the database of the primary, they read from secondaryPreferred
+	// unless ReadPreference or the readPreference of the uri is set.
+	Replicas []string
+	// how to choose a replica, ReplicaRoundRobin by default.
+	ReplicaPolicy ReplicaPolicy
+}
+
+// NewDataBaseOptions get the default options, the same as RegisterDataBase without params.
+func NewDataBaseOptions() DataBaseOptions {
+	return DataBaseOptions{
+		InitialCap:          5,
+		MaxCap:              20,
+		IdleTimeout:         30 * time.Second,
+		WaitTimeout:         10 * time.Second,
+		MaintainInterval:    pool.DefaultMaintainInterval,
+		HealthCheckInterval: pool.DefaultHealthCheckInterval,
+	}
+}
+
+// get the pool config of options.
+func (opts DataBaseOptions) poolConfig() pool.Config {
+	return pool.Config{
+		InitialCap:          opts.InitialCap,
+		MaxCap:              opts.MaxCap,
+		IdleTimeout:         opts.IdleTimeout,
+		MaxLifetime:         opts.MaxLifetime,
+		WaitTimeout:         opts.WaitTimeout,
+		MaintainInterval:    opts.MaintainInterval,
+		HealthCheckInterval: opts.HealthCheckInterval,
+	}
+}
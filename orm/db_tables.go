@@ -346,6 +346,9 @@ func (t *dbTables) getCondSQL(cond *Condition, sub bool, tz *time.Location) (whe
 		if p.isNot {
 			where += "NOT "
 		}
+		if p.filter != nil {
+			panic(fmt.Errorf("<Condition.RawBson> is only supported by mongodb"))
+		}
 		if p.isCond {
 			w, ps := t.getCondSQL(p.cond, true, tz)
 			if w != "" {
@@ -358,10 +361,13 @@ func (t *dbTables) getCondSQL(cond *Condition, sub bool, tz *time.Location) (whe
 
 			num := len(exprs) - 1
 			operator := ""
-			if operators[exprs[num]] {
+			if num > 0 && operators[exprs[num]] {
 				operator = exprs[num]
 				exprs = exprs[:num]
 			}
+			if mongoOnlyOperators[operator] {
+				panic(fmt.Errorf("operator `%s` is only supported by mongodb", operator))
+			}
 
 			index, _, fi, suc := t.parseExprs(mi, exprs)
 			if !suc {
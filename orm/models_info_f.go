@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 )
 
 var errSkipField = errors.New("skip field")
@@ -137,6 +138,8 @@ type fieldInfo struct {
 	isFielder           bool // implement Fielder interface
 	onDelete            string
 	description         string
+	dbType              string        // the database type of tag type, e.g. LowCardinality(String)
+	ttl                 time.Duration // expire time of the mongodb ttl index
 }
 
 // new field info
@@ -307,6 +310,24 @@ checkType:
 	fi.fullName = mi.fullName + mName + "." + sf.Name
 
 	fi.description = tags["description"]
+	switch tags["type"] {
+	case "", "char", "text", "json", "jsonb", "date", "datetime", "time":
+	default:
+		fi.dbType = tags["type"]
+	}
+	if v := tags["ttl"]; v != "" {
+		if fieldType != TypeDateTimeField && fieldType != TypeDateField {
+			err = fmt.Errorf("ttl only support time field")
+			goto end
+		}
+		// seconds or duration, e.g. ttl(3600) or ttl(24h)
+		if secs, e := StrTo(v).Int32(); e == nil {
+			fi.ttl = time.Duration(secs) * time.Second
+		} else if fi.ttl, err = time.ParseDuration(v); err != nil {
+			tag, tagValue = "ttl", v
+			goto wrongTag
+		}
+	}
 	fi.null = attrs["null"]
 	fi.index = attrs["index"]
 	fi.auto = attrs["auto"]
@@ -435,8 +456,8 @@ checkType:
 		fi.index = false
 	}
 
-	// can not set default for these type
-	if fi.auto || fi.pk || fi.unique || fieldType == TypeTimeField || fieldType == TypeDateField || fieldType == TypeDateTimeField {
+	// can not set default for these fields, the default of the time fields is only used by the clickhouse DDL
+	if fi.auto || fi.pk || fi.unique {
 		initial.Clear()
 	}
 
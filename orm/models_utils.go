@@ -47,6 +47,7 @@ var supportTag = map[string]int{
 	"on_delete":    2,
 	"type":         2,
 	"description":  2,
+	"ttl":          2,
 }
 
 // get reflect.Type name with package path.
@@ -93,6 +94,42 @@ func getTablePk(val reflect.Value) string {
 	return ""
 }
 
+// get table partition expression of clickhouse, e.g. "toYYYYMM(_date)".
+func getTablePartition(val reflect.Value) string {
+	fun := val.MethodByName("TablePartition")
+	if fun.IsValid() {
+		vals := fun.Call([]reflect.Value{})
+		if len(vals) > 0 && vals[0].Kind() == reflect.String {
+			return vals[0].String()
+		}
+	}
+	return ""
+}
+
+// get table ttl expression of clickhouse, e.g. "_date + INTERVAL 30 DAY".
+func getTableTTL(val reflect.Value) string {
+	fun := val.MethodByName("TableTTL")
+	if fun.IsValid() {
+		vals := fun.Call([]reflect.Value{})
+		if len(vals) > 0 && vals[0].Kind() == reflect.String {
+			return vals[0].String()
+		}
+	}
+	return ""
+}
+
+// get table settings of clickhouse, e.g. "index_granularity = 8192".
+func getTableSettings(val reflect.Value) string {
+	fun := val.MethodByName("TableSettings")
+	if fun.IsValid() {
+		vals := fun.Call([]reflect.Value{})
+		if len(vals) > 0 && vals[0].Kind() == reflect.String {
+			return vals[0].String()
+		}
+	}
+	return ""
+}
+
 // get table index from method.
 func getTableIndex(val reflect.Value) [][]string {
 	fun := val.MethodByName("TableIndex")
@@ -245,7 +282,7 @@ func parseStructTag(data string) (attrs map[string]bool, tags map[string]string)
 		v = strings.TrimSpace(v)
 		if t := strings.ToLower(v); supportTag[t] == 1 {
 			attrs[t] = true
-		} else if i := strings.Index(v, "("); i > 0 && strings.Index(v, ")") == len(v)-1 {
+		} else if i := strings.Index(v, "("); i > 0 && strings.HasSuffix(v, ")") {
 			name := t[:i]
 			if supportTag[name] == 2 {
 				v = v[i+1 : len(v)-1]
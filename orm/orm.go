@@ -9,12 +9,15 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 type orm struct {
-	alias *alias
-	isTx  bool
-	db    dbQuerier
+	alias        *alias
+	primary      bool
+	writeConcern *writeconcern.WriteConcern
+	mutationWait MutationWait
+	db           *DB
 }
 
 // 下划线用来判断结构体是否实现了接口，
@@ -27,6 +30,7 @@ var (
 	DefaultRowsLimit = -1
 	DefaultRelsDepth = 2
 	DefaultTimeLoc   = time.Local
+	DefaultTxRetries = 3
 	ErrTxHasBegan    = errors.New("<Ormer.Begin> transaction already begin")
 	ErrTxDone        = errors.New("<Ormer.Commit/Rollback> transaction not begin")
 	ErrMultiRows     = errors.New("<QuerySeter> return multi rows")
@@ -36,6 +40,7 @@ var (
 	ErrNotImplement  = errors.New("have not implement")
 	ErrHaveNoPK      = errors.New("<Ormer> the PK value should not be nil")
 	ErrNoDocuments   = mongo.ErrNoDocuments
+	ErrStopIteration = errors.New("<QuerySeter.Iterate> stop iteration")
 	todo             = context.TODO()
 )
 
@@ -68,28 +73,121 @@ func (o *orm) getMiInd(md interface{}, needPtr bool) (mi *modelInfo, ind reflect
 	panic(fmt.Errorf("<Ormer> table: `%s` not found, make sure it was registered with `RegisterModel()`", name))
 }
 
-func (o *orm) RawDB() interface{} {
+// lease a db for one operation, inside a transaction the db of the transaction is shared
+// and given back to the pool by Commit or Rollback.
+// ctx gets the QueryTimeout of the alias when it has no deadline, release also cancels it.
+func (o *orm) acquire(ctx context.Context) (_ context.Context, db *DB, release func(), err error) {
+	return o.acquireFrom(ctx, o.alias.Name)
+}
+
+// lease a db for the reads of QuerySeter, they go to a replica of the alias
+// unless in a transaction or UsePrimary is set.
+func (o *orm) acquireRead(ctx context.Context) (_ context.Context, db *DB, release func(), err error) {
+	return o.acquireFrom(ctx, o.readPool())
+}
+
+// lease a db for the rows of QuerySeter. the QueryTimeout of the alias only bounds opening
+// the cursor, opened stops it and reports false when it already expired, so the rows are
+// read until ctx is done or release.
+func (o *orm) acquireRows(ctx context.Context) (_ context.Context, db *DB, opened func() bool, release func(), err error) {
+	timeout := false
+	if _, ok := ctx.Deadline(); !ok && o.alias.QueryTimeout > 0 {
+		timeout = true
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	opened = func() bool { return true }
+	if timeout {
+		timer := time.AfterFunc(o.alias.QueryTimeout, cancel)
+		opened = timer.Stop
+	}
+	ctx, db, release, err = o.lease(ctx, o.readPool(), cancel)
+	return ctx, db, opened, release, err
+}
+
+// get the pool of the reads of QuerySeter.
+func (o *orm) readPool() string {
+	if o.isTx() || o.primary || len(o.alias.Replicas) == 0 {
+		return o.alias.Name
+	}
+	return o.alias.replica()
+}
+
+// lease a db from the pool named poolName.
+func (o *orm) acquireFrom(ctx context.Context, poolName string) (_ context.Context, db *DB, release func(), err error) {
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok && o.alias.QueryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.alias.QueryTimeout)
+	}
+	return o.lease(ctx, poolName, cancel)
+}
+
+// lease a db from the pool named poolName, cancel is called by release.
+func (o *orm) lease(ctx context.Context, poolName string, cancel func()) (_ context.Context, db *DB, release func(), err error) {
+	if o.isTx() {
+		if o.writeConcern != o.db.writeConcern {
+			cancel()
+			return nil, nil, nil, ErrTxWriteConcern
+		}
+		// the copy shares the session and the tx, only the options of this Ormer differ.
+		tx := *o.db
+		tx.mutationWait = o.mutationWait
+		return ctx, &tx, cancel, nil
+	}
+	db, err = o.alias.getDB(ctx, poolName)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, err
+	}
+	db.writeConcern = o.writeConcern
+	db.mutationWait = o.mutationWait
+	return ctx, db, func() {
+		db.release()
+		cancel()
+	}, nil
+}
+
+// return *mongo.Database or *sql.DB with the release func of its connection, the connection
+// belongs to the caller until release is called. inside a transaction release does nothing.
+func (o *orm) RawDB() (interface{}, func(), error) {
+	_, db, release, err := o.acquire(todo)
+	if err != nil {
+		return nil, nil, err
+	}
 	if o.alias.Driver == DRMongo {
-		return o.alias.DB.MDB
-	} else {
-		return o.alias.DB.DB
+		return db.MDB, release, nil
 	}
+	return db.DB, release, nil
 }
 
 // read data to model
 func (o *orm) Read(md interface{}, cols ...string) (err error) {
+	return o.ReadWithCtx(todo, md, cols...)
+}
+
+// read data to model with context
+func (o *orm) ReadWithCtx(ctx context.Context, md interface{}, cols ...string) (err error) {
 	mi, ind := o.getMiInd(md, true)
-	return o.alias.DbBaser.Read(o.db, mi, ind, md, o.alias.TZ, cols, false)
+	ctx, db, release, err := o.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return o.alias.DbBaser.Read(ctx, db, mi, ind, md, o.alias.TZ, cols, false)
 }
 
 // Try to read a row from the database, or insert one if it doesn't exist
 func (o *orm) ReadOrCreate(md interface{}, col1 string, cols ...string) (created bool, id interface{}, err error) {
+	return o.ReadOrCreateWithCtx(todo, md, col1, cols...)
+}
+
+// Try to read a row from the database with context, or insert one if it doesn't exist
+func (o *orm) ReadOrCreateWithCtx(ctx context.Context, md interface{}, col1 string, cols ...string) (created bool, id interface{}, err error) {
 	cols = append([]string{col1}, cols...)
 	mi, ind := o.getMiInd(md, true)
-	err = o.alias.DbBaser.Read(o.db, mi, ind, md, o.alias.TZ, cols, false)
+	err = o.ReadWithCtx(ctx, md, cols...)
 	if err == mongo.ErrNoDocuments || err == ErrNoRows {
 		// Create
-		id, err = o.Insert(md)
+		id, err = o.InsertWithCtx(ctx, md)
 		return (err == nil), id, err
 	}
 
@@ -97,7 +195,7 @@ func (o *orm) ReadOrCreate(md interface{}, col1 string, cols ...string) (created
 	if mi.fields.pk.fieldType&IsPositiveIntegerField > 0 {
 		id = int64(vid.Uint())
 	} else if mi.fields.pk.rel {
-		return o.ReadOrCreate(vid.Interface(), mi.fields.pk.relModelInfo.fields.pk.name)
+		return o.ReadOrCreateWithCtx(ctx, vid.Interface(), mi.fields.pk.relModelInfo.fields.pk.name)
 	} else {
 		id = vid.Interface()
 	}
@@ -107,13 +205,27 @@ func (o *orm) ReadOrCreate(md interface{}, col1 string, cols ...string) (created
 
 // insert model data to database
 func (o *orm) Insert(md interface{}) (id interface{}, err error) {
+	return o.InsertWithCtx(todo, md)
+}
+
+// insert model data to database with context
+func (o *orm) InsertWithCtx(ctx context.Context, md interface{}) (id interface{}, err error) {
 	mi, ind := o.getMiInd(md, true)
-	id, err = o.alias.DbBaser.InsertOne(o.db, mi, ind, md, o.alias.TZ)
-	return
+	ctx, db, release, err := o.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return o.alias.DbBaser.InsertOne(ctx, db, mi, ind, md, o.alias.TZ)
 }
 
 // insert models data to database
 func (o *orm) InsertMulti(bulk int, mds interface{}) (ids interface{}, err error) {
+	return o.InsertMultiWithCtx(todo, bulk, mds)
+}
+
+// insert models data to database with context
+func (o *orm) InsertMultiWithCtx(ctx context.Context, bulk int, mds interface{}) (ids interface{}, err error) {
 	sind := reflect.Indirect(reflect.ValueOf(mds))
 	switch sind.Kind() {
 	case reflect.Array, reflect.Slice:
@@ -126,21 +238,45 @@ func (o *orm) InsertMulti(bulk int, mds interface{}) (ids interface{}, err error
 
 	ind := reflect.Indirect(sind.Index(0))
 	mi, _ := o.getMiInd(ind.Interface(), false)
-	ids, err = o.alias.DbBaser.InsertMulti(o.db, mi, sind, bulk, mds, o.alias.TZ)
-	return
+	ctx, db, release, err := o.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return o.alias.DbBaser.InsertMulti(ctx, db, mi, sind, bulk, mds, o.alias.TZ)
 }
 
 // cols set the columns those want to update.
 func (o *orm) Update(md interface{}, cols ...string) (interface{}, error) {
+	return o.UpdateWithCtx(todo, md, cols...)
+}
+
+// cols set the columns those want to update, with context.
+func (o *orm) UpdateWithCtx(ctx context.Context, md interface{}, cols ...string) (interface{}, error) {
 	mi, ind := o.getMiInd(md, true)
-	return o.alias.DbBaser.Update(o.db, mi, ind, o.alias.TZ, cols)
+	ctx, db, release, err := o.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return o.alias.DbBaser.Update(ctx, db, mi, ind, o.alias.TZ, cols)
 }
 
 // delete model in database
 // cols shows the delete conditions values read from. default is pk
 func (o *orm) Delete(md interface{}, cols ...string) (interface{}, error) {
+	return o.DeleteWithCtx(todo, md, cols...)
+}
+
+// delete model in database with context
+func (o *orm) DeleteWithCtx(ctx context.Context, md interface{}, cols ...string) (interface{}, error) {
 	mi, ind := o.getMiInd(md, true)
-	return o.alias.DbBaser.Delete(o.db, mi, ind, o.alias.TZ, cols)
+	ctx, db, release, err := o.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return o.alias.DbBaser.Delete(ctx, db, mi, ind, o.alias.TZ, cols)
 }
 
 // set auto pk field
@@ -176,6 +312,31 @@ func (o *orm) QueryTable(ptrStructOrTableName interface{}) (qs QuerySeter) {
 	return
 }
 
+// return a copy of the Ormer whose QuerySeter reads go to the primary instead of a replica.
+// inside a transaction everything goes to the primary already.
+func (o *orm) UsePrimary() Ormer {
+	if o.isTx() {
+		return o
+	}
+	p := *o
+	p.primary = true
+	return &p
+}
+
+// return a copy of the Ormer whose mongodb writes use wc, call it before Begin to commit the transaction with wc.
+func (o *orm) WriteConcern(wc *writeconcern.WriteConcern) Ormer {
+	c := *o
+	c.writeConcern = wc
+	return &c
+}
+
+// return a copy of the Ormer whose clickhouse Update waits for the mutation as wait.
+func (o *orm) MutationWait(wait MutationWait) Ormer {
+	c := *o
+	c.mutationWait = wait
+	return &c
+}
+
 func NewOrm() Ormer {
 	BootStrap() // execute only once
 
@@ -188,59 +349,106 @@ func NewOrm() Ormer {
 }
 
 func (o *orm) Using(name string) error {
-	if o.isTx {
+	if o.isTx() {
 		panic(fmt.Errorf("<Ormer.Using> transaction has been start, cannot change db"))
 	}
 	if al, ok := dataBaseCache.get(name); ok {
 		o.alias = al
-		db, err := al.getDB()
-		if err != nil {
-			return err
-		}
-		o.db = db
 	} else {
 		return fmt.Errorf("<Ormer.Using> unknown db alias name `%s`", name)
 	}
 	return nil
 }
 
+// the transaction is kept by the db shared with the copies of the Ormer,
+// so ending it through any copy ends it for all of them.
+func (o *orm) isTx() bool {
+	return o.db != nil && o.db.isTx
+}
+
+// begin a transaction, the operations of this Ormer join it until Commit or Rollback,
+// one connection of the pool is held by the transaction until then.
+// on mongodb the deployment must be a replica set or a sharded cluster.
 func (o *orm) Begin() (err error) {
-	if o.isTx {
-		return
+	return o.BeginWithCtx(todo)
+}
+
+// begin a transaction with context, ctx is also used to commit or rollback it.
+func (o *orm) BeginWithCtx(ctx context.Context) (err error) {
+	if o.isTx() {
+		return ErrTxHasBegan
 	}
 
-	err = o.db.Begin()
+	db, err := o.alias.getDB(ctx, o.alias.Name)
 	if err != nil {
 		return err
 	}
-	o.isTx = true
+	db.writeConcern = o.writeConcern
+	err = db.BeginTx(ctx)
+	if err != nil {
+		db.release()
+		return err
+	}
+	o.db = db
 	return
 }
 
+// commit the transaction, the session of mongodb is ended whether it succeeded or not.
+// a failed mongodb commit returns *TxError when the server labels it retryable.
 func (o *orm) Commit() (err error) {
-	if !o.isTx {
+	if !o.isTx() {
 		return ErrTxDone
 	}
 	err = o.db.Commit()
-	if err == nil {
-		o.isTx = false
-		o.Using(o.alias.Name)
-	} else {
-		return ErrTxDone
-	}
+	o.db.release()
+	o.db = nil
 	return
 }
+
+// abort the transaction.
 func (o *orm) Rollback() (err error) {
-	if !o.isTx {
+	if !o.isTx() {
 		return ErrTxDone
 	}
 	err = o.db.Rollback()
+	o.db.release()
+	o.db = nil
+	return
+}
+
+// run task in a transaction, commit when it returns nil, rollback when it returns an error or panics.
+// the whole task is retried at most DefaultTxRetries times when mongodb labels the error
+// TransientTransactionError or UnknownTransactionCommitResult.
+func (o *orm) DoTx(ctx context.Context, task func(ctx context.Context, txOrm TxOrmer) error) (err error) {
+	if o.isTx() {
+		return ErrTxHasBegan
+	}
+	for i := 0; ; i++ {
+		err = o.doTx(ctx, task)
+		if i >= DefaultTxRetries || !isRetryableTxError(err) || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// run task once in a transaction.
+func (o *orm) doTx(ctx context.Context, task func(ctx context.Context, txOrm TxOrmer) error) (err error) {
+	if err = o.BeginWithCtx(ctx); err != nil {
+		return
+	}
+	done := false
+	defer func() {
+		// rollback on error and on panic, the panic goes on after rollback.
+		if !done || err != nil {
+			o.Rollback()
+		}
+	}()
+
+	err = task(ctx, o)
 	if err == nil {
-		o.isTx = false
-		o.Using(o.alias.Name)
-	} else {
-		return ErrTxDone
+		err = o.Commit()
 	}
+	done = true
 	return
 }
 
@@ -0,0 +1,352 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/souliot/siot-orm/pool"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInserterClosed = errors.New("<BufferedInserter> inserter already closed")
+)
+
+// BufferedInserterOptions define the options of BufferedInserter.
+type BufferedInserterOptions struct {
+	// flush when the buffered rows reach BatchSize, it's also the bulk of InsertMulti
+	BatchSize int
+	// flush the buffered rows at least once in FlushInterval
+	FlushInterval time.Duration
+	// max rows waiting in the queue, Insert blocks when it's full
+	QueueSize int
+	// called with the error and the rows of a failed flush, the rows spilled to disk are not included
+	OnError func(err error, rows []interface{})
+	// when set, the rows failed because of the unreachable server are written to the dir,
+	// and inserted again every RetryInterval, including the files left by the last run.
+	// a file which cannot be decoded is reported to OnError and renamed with the suffix .corrupt
+	SpillDir      string
+	RetryInterval time.Duration
+}
+
+// NewBufferedInserterOptions return the default options of BufferedInserter.
+func NewBufferedInserterOptions() BufferedInserterOptions {
+	return BufferedInserterOptions{
+		BatchSize:     10000,
+		FlushInterval: time.Second,
+		QueueSize:     20000,
+		RetryInterval: 30 * time.Second,
+	}
+}
+
+// BufferedInserter buffer the models inserted from many goroutines,
+// and insert them by InsertMulti when the buffer is full or FlushInterval passed.
+type BufferedInserter struct {
+	orm   *orm
+	mi    *modelInfo
+	typ   reflect.Type
+	opts  BufferedInserterOptions
+	queue chan interface{}
+	mux   sync.RWMutex
+	// closed is guarded by mux, the queue is closed with it
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+	// the first error of the flushes, written by run only
+	firstErr error
+	seq      uint64
+}
+
+// NewBufferedInserter create a BufferedInserter of model on the db alias,
+// model is a registered model struct or its pointer, the zero options use the default ones.
+func NewBufferedInserter(aliasName string, model interface{}, opts BufferedInserterOptions) (*BufferedInserter, error) {
+	BootStrap()
+	o := new(orm)
+	if err := o.Using(aliasName); err != nil {
+		return nil, err
+	}
+	mi, ind := o.getMiInd(model, false)
+	return newBufferedInserter(o, mi, ind.Type(), opts)
+}
+
+// create the BufferedInserter of mi on the alias of o, typ is the model struct.
+func newBufferedInserter(o *orm, mi *modelInfo, typ reflect.Type, opts BufferedInserterOptions) (*BufferedInserter, error) {
+	def := NewBufferedInserterOptions()
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = def.BatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = def.FlushInterval
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = opts.BatchSize * 2
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = def.RetryInterval
+	}
+	if opts.SpillDir != "" {
+		if err := os.MkdirAll(opts.SpillDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	b := &BufferedInserter{
+		orm:   o,
+		mi:    mi,
+		typ:   typ,
+		opts:  opts,
+		queue: make(chan interface{}, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	if opts.SpillDir != "" {
+		b.wg.Add(1)
+		go b.retry()
+	}
+	return b, nil
+}
+
+// Insert add a model to the buffer, it blocks when the queue is full until ctx is done.
+func (b *BufferedInserter) Insert(ctx context.Context, md interface{}) error {
+	val := reflect.ValueOf(md)
+	ind := reflect.Indirect(val)
+	if ind.Type() != b.typ {
+		panic(fmt.Errorf("<BufferedInserter> wrong model type `%T`, need *%s", md, b.mi.fullName))
+	}
+	if val.Kind() != reflect.Ptr {
+		// keep a copy, the slice of InsertMulti holds pointers
+		ptr := reflect.New(b.typ)
+		ptr.Elem().Set(ind)
+		md = ptr.Interface()
+	}
+
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	if b.closed {
+		return ErrInserterClosed
+	}
+	select {
+	case b.queue <- md:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stop accepting models, flush the buffered ones and wait for it.
+// the error of the first failed flush is returned, including the ones before Close,
+// the spilled rows are not errors.
+func (b *BufferedInserter) Close() error {
+	b.mux.Lock()
+	if b.closed {
+		b.mux.Unlock()
+		return ErrInserterClosed
+	}
+	b.closed = true
+	close(b.queue)
+	b.mux.Unlock()
+
+	close(b.done)
+	b.wg.Wait()
+	return b.firstErr
+}
+
+// read the queue and flush on size or interval until the queue is closed.
+func (b *BufferedInserter) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+
+	rows := make([]interface{}, 0, b.opts.BatchSize)
+	flush := func() {
+		if err := b.flush(rows); err != nil && b.firstErr == nil {
+			b.firstErr = err
+		}
+		rows = make([]interface{}, 0, b.opts.BatchSize)
+	}
+	for {
+		select {
+		case md, ok := <-b.queue:
+			if !ok {
+				flush()
+				return
+			}
+			rows = append(rows, md)
+			if len(rows) >= b.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			if len(rows) > 0 {
+				flush()
+			}
+		}
+	}
+}
+
+// insert the rows, the rows of failed chunks are spilled or reported to OnError.
+func (b *BufferedInserter) flush(rows []interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	err := b.insert(rows)
+	if err == nil {
+		return nil
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		return b.fail(err, rows)
+	}
+	err = nil
+	for _, chunk := range batchErr.Chunks {
+		if ferr := b.fail(chunk.Err, rows[chunk.Offset:chunk.Offset+chunk.Rows]); ferr != nil {
+			err = batchErr
+		}
+	}
+	return err
+}
+
+// spill the rows when the server is unreachable, otherwise report them to OnError.
+func (b *BufferedInserter) fail(err error, rows []interface{}) error {
+	if b.opts.SpillDir != "" && isUnreachable(err) {
+		serr := b.spill(rows)
+		if serr == nil {
+			return nil
+		}
+		err = fmt.Errorf("%s, spill failed: %w", err, serr)
+	}
+	b.report(err, rows)
+	return err
+}
+
+func (b *BufferedInserter) report(err error, rows []interface{}) {
+	if b.opts.OnError != nil {
+		b.opts.OnError(err, rows)
+	}
+}
+
+// insert the rows by InsertMulti of the model.
+func (b *BufferedInserter) insert(rows []interface{}) error {
+	slice := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(b.typ)), 0, len(rows))
+	for _, row := range rows {
+		slice = reflect.Append(slice, reflect.ValueOf(row))
+	}
+	ctx, db, release, err := b.orm.acquire(todo)
+	if err != nil {
+		return err
+	}
+	defer release()
+	_, err = b.orm.alias.DbBaser.InsertMulti(ctx, db, b.mi, slice, b.opts.BatchSize, slice.Interface(), b.orm.alias.TZ)
+	return err
+}
+
+// write the rows to a file of SpillDir as a gob stream, which keeps the exact values of the fields.
+func (b *BufferedInserter) spill(rows []interface{}) error {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	name := fmt.Sprintf("%s-%d-%d.gob", b.mi.table, time.Now().UnixNano(), atomic.AddUint64(&b.seq, 1))
+	tmp := filepath.Join(b.opts.SpillDir, "."+name)
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	// rename after written, so a partial file is never read by retry
+	return os.Rename(tmp, filepath.Join(b.opts.SpillDir, name))
+}
+
+// insert the spilled files again every RetryInterval until closed.
+func (b *BufferedInserter) retry() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.opts.RetryInterval)
+	defer ticker.Stop()
+
+	b.retrySpilled()
+	for {
+		select {
+		case <-ticker.C:
+			b.retrySpilled()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// insert the spilled files of the table, a file is removed once inserted.
+// it stops at the first file failed because of the unreachable server,
+// a corrupt file is moved aside so it does not block the others.
+func (b *BufferedInserter) retrySpilled() {
+	files, err := filepath.Glob(filepath.Join(b.opts.SpillDir, b.mi.table+"-*.gob"))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.report(fmt.Errorf("read spilled file `%s` failed: %w", file, err), nil)
+			continue
+		}
+		rows, err := b.decodeSpilled(data)
+		if err != nil {
+			b.report(fmt.Errorf("decode spilled file `%s` failed: %w", file, err), rows)
+			if err = os.Rename(file, file+".corrupt"); err != nil {
+				b.report(err, nil)
+			}
+			continue
+		}
+		if err = b.insert(rows); err != nil {
+			if isUnreachable(err) {
+				return
+			}
+			b.report(fmt.Errorf("insert spilled file `%s` failed: %w", file, err), rows)
+		}
+		os.Remove(file)
+	}
+}
+
+// decode the models of a spilled file, the rows before an error are returned with it.
+func (b *BufferedInserter) decodeSpilled(data []byte) ([]interface{}, error) {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	var rows []interface{}
+	for {
+		ptr := reflect.New(b.typ)
+		err := dec.Decode(ptr.Interface())
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, ptr.Interface())
+	}
+}
+
+// check err of an insert is caused by the unreachable server or the exhausted pool.
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, pool.ErrWaitTimeout) || errors.Is(err, ErrDBConnection) ||
+		mongo.IsNetworkError(err) || mongo.IsTimeout(err)
+}
@@ -0,0 +1,270 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type bufferRow struct {
+	Id      uint64    `orm:"pk"`
+	Created time.Time `orm:"type(datetime)"`
+	Name    string
+}
+
+// bufferBaser record the inserted batches, InsertMulti fails with err when it's set.
+type bufferBaser struct {
+	dbBaser
+	mu      sync.Mutex
+	batches [][]*bufferRow
+	err     error
+	failed  int
+}
+
+func (d *bufferBaser) InsertMulti(ctx context.Context, q dbQuerier, mi *modelInfo, sind reflect.Value, bulk int, mds interface{}, tz *time.Location) (interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		d.failed++
+		return nil, d.err
+	}
+	rows := append([]*bufferRow(nil), mds.([]*bufferRow)...)
+	d.batches = append(d.batches, rows)
+	return int64(len(rows)), nil
+}
+
+func (d *bufferBaser) setErr(err error) {
+	d.mu.Lock()
+	d.err = err
+	d.mu.Unlock()
+}
+
+// get the sizes of the inserted batches and the inserted rows.
+func (d *bufferBaser) inserted() (sizes []int, rows []*bufferRow) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, batch := range d.batches {
+		sizes = append(sizes, len(batch))
+		rows = append(rows, batch...)
+	}
+	return
+}
+
+func newTestInserter(t *testing.T, baser *bufferBaser, opts BufferedInserterOptions) *BufferedInserter {
+	o := &orm{alias: &alias{DbBaser: baser, TZ: time.UTC}, db: &DB{isTx: true}}
+	mi := newModelInfo(reflect.ValueOf(new(bufferRow)))
+	mi.table = "buffer_row"
+	b, err := newBufferedInserter(o, mi, reflect.TypeOf(bufferRow{}), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// wait until cond is true or fail after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+	}
+}
+
+func TestBufferedInserterFlush(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     BufferedInserterOptions
+		rows     int
+		waitSize []int
+		want     []int
+	}{
+		// the last row is flushed by Close
+		{name: "size", opts: BufferedInserterOptions{BatchSize: 3, FlushInterval: time.Hour}, rows: 7, waitSize: []int{3, 3}, want: []int{3, 3, 1}},
+		{name: "interval", opts: BufferedInserterOptions{BatchSize: 100, FlushInterval: 10 * time.Millisecond}, rows: 2, waitSize: []int{2}, want: []int{2}},
+		{name: "close", opts: BufferedInserterOptions{BatchSize: 100, FlushInterval: time.Hour}, rows: 5, want: []int{5}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			baser := new(bufferBaser)
+			b := newTestInserter(t, baser, c.opts)
+			for i := 0; i < c.rows; i++ {
+				// a struct is copied, a pointer is kept
+				var row interface{} = bufferRow{Id: uint64(i)}
+				if i%2 == 1 {
+					row = &bufferRow{Id: uint64(i)}
+				}
+				if err := b.Insert(context.Background(), row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.waitSize != nil {
+				waitFor(t, "flush", func() bool {
+					sizes, _ := baser.inserted()
+					return reflect.DeepEqual(sizes, c.waitSize)
+				})
+			}
+
+			if err := b.Close(); err != nil {
+				t.Fatal(err)
+			}
+			sizes, rows := baser.inserted()
+			if !reflect.DeepEqual(sizes, c.want) {
+				t.Errorf("batches = %v, want %v", sizes, c.want)
+			}
+			for i, row := range rows {
+				if row.Id != uint64(i) {
+					t.Errorf("row %d = %d, the order is not kept", i, row.Id)
+				}
+			}
+			if err := b.Insert(context.Background(), &bufferRow{}); err != ErrInserterClosed {
+				t.Errorf("Insert() after Close err = %v, want %v", err, ErrInserterClosed)
+			}
+		})
+	}
+}
+
+func TestBufferedInserterError(t *testing.T) {
+	baser := &bufferBaser{err: errors.New("bad row")}
+	var reported []interface{}
+	b := newTestInserter(t, baser, BufferedInserterOptions{
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		SpillDir:      t.TempDir(),
+		OnError:       func(err error, rows []interface{}) { reported = rows },
+	})
+	b.Insert(context.Background(), &bufferRow{Id: 1})
+
+	// not spilled, the server is reachable
+	if err := b.Close(); err == nil || err.Error() != "bad row" {
+		t.Errorf("Close() err = %v, want bad row", err)
+	}
+	if len(reported) != 1 || reported[0].(*bufferRow).Id != 1 {
+		t.Errorf("reported rows = %v", reported)
+	}
+	if files, _ := filepath.Glob(filepath.Join(b.opts.SpillDir, "*")); len(files) != 0 {
+		t.Errorf("spilled files = %v, want none", files)
+	}
+}
+
+func TestBufferedInserterFirstError(t *testing.T) {
+	baser := &bufferBaser{err: errors.New("bad row")}
+	b := newTestInserter(t, baser, BufferedInserterOptions{BatchSize: 1, FlushInterval: time.Hour})
+	b.Insert(context.Background(), &bufferRow{Id: 1})
+
+	// the flush of the size fails without OnError, the last flush succeeds
+	waitFor(t, "flush", func() bool {
+		baser.mu.Lock()
+		defer baser.mu.Unlock()
+		return baser.failed == 1
+	})
+	baser.setErr(nil)
+	b.Insert(context.Background(), &bufferRow{Id: 2})
+
+	if err := b.Close(); err == nil || err.Error() != "bad row" {
+		t.Errorf("Close() err = %v, want bad row", err)
+	}
+	if _, rows := baser.inserted(); len(rows) != 1 || rows[0].Id != 2 {
+		t.Errorf("inserted rows = %v, want row 2", rows)
+	}
+}
+
+func TestBufferedInserterSpill(t *testing.T) {
+	dir := t.TempDir()
+	baser := &bufferBaser{err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	var mu sync.Mutex
+	var reported []error
+	opts := BufferedInserterOptions{
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		SpillDir:      dir,
+		RetryInterval: 10 * time.Millisecond,
+		OnError: func(err error, rows []interface{}) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		},
+	}
+
+	// the values survive the spill exactly
+	created := time.Date(2026, 10, 17, 1, 2, 3, 123456789, time.UTC)
+	want := []*bufferRow{
+		{Id: math.MaxUint64, Created: created, Name: "a"},
+		{Id: 2, Created: created.Add(time.Nanosecond), Name: "b"},
+	}
+	b := newTestInserter(t, baser, opts)
+	for _, row := range want {
+		b.Insert(context.Background(), row)
+	}
+	waitFor(t, "spill", func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "buffer_row-*.gob"))
+		return len(files) == 1
+	})
+	if err := b.Close(); err != nil {
+		t.Errorf("Close() err = %v, spilled rows are not errors", err)
+	}
+
+	// a corrupt file does not block the spilled one
+	corrupt := filepath.Join(dir, "buffer_row-1-1.gob")
+	if err := ioutil.WriteFile(corrupt, []byte("not gob"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the files left by the last run are inserted when the server is back
+	baser.setErr(nil)
+	b = newTestInserter(t, baser, opts)
+	waitFor(t, "retry", func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "buffer_row-*.gob"))
+		return len(files) == 0
+	})
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, rows := baser.inserted()
+	if len(rows) != len(want) {
+		t.Fatalf("inserted %d rows, want %d", len(rows), len(want))
+	}
+	for i, row := range rows {
+		if row.Id != want[i].Id || !row.Created.Equal(want[i].Created) || row.Name != want[i].Name {
+			t.Errorf("row %d = %+v, want %+v", i, row, want[i])
+		}
+	}
+	if _, err := os.Stat(corrupt + ".corrupt"); err != nil {
+		t.Errorf("corrupt file not moved aside: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || !strings.HasPrefix(reported[0].Error(), "decode spilled file") {
+		t.Errorf("reported errors = %v, want the corrupt file", reported)
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{&os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}, true},
+		{&BatchError{Chunks: []*ChunkError{{Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}}}, true},
+		{ErrDBConnection, true},
+		{errors.New("connection refused"), false},
+		{errors.New("Code: 60, Table default.x doesn't exist"), false},
+	}
+	for _, c := range cases {
+		if got := isUnreachable(c.err); got != c.want {
+			t.Errorf("isUnreachable(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
@@ -17,6 +17,8 @@ package orm
 import (
 	"fmt"
 	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 // ExprSep define the expression separation
@@ -33,6 +35,7 @@ type condValue struct {
 	isCond bool
 	isRaw  bool
 	sql    string
+	filter bson.M
 }
 
 // Condition struct.
@@ -56,6 +59,15 @@ func (c Condition) Raw(expr string, sql string) *Condition {
 	return &c
 }
 
+// RawBson add a mongodb filter to condition as it is, for mongodb only
+func (c Condition) RawBson(filter bson.M) *Condition {
+	if len(filter) == 0 {
+		panic(fmt.Errorf("<Condition.RawBson> filter cannot empty"))
+	}
+	c.params = append(c.params, condValue{filter: filter})
+	return &c
+}
+
 // And add expression to condition
 func (c Condition) And(expr string, args ...interface{}) *Condition {
 	if expr == "" || len(args) == 0 {
@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -18,26 +19,39 @@ type Index struct {
 	options.IndexOptions
 }
 type indexView struct {
-	index mongo.IndexView
+	orm   *orm
+	table string
 }
 
 var _ IndexViewer = new(indexView)
 
 // list all index
-func (iv *indexView) List() (val interface{}, err error) {
+func (iv *indexView) List(ctx context.Context) (val interface{}, err error) {
+	ctx, view, release, err := iv.view(ctx)
+	if err != nil {
+		return
+	}
+	defer release()
+
 	res := []map[string]interface{}{}
 	opt := options.ListIndexes()
-	cur, err := iv.index.List(todo, opt)
+	cur, err := view.List(ctx, opt)
 	if err != nil {
 		return
 	}
-	defer cur.Close(todo)
-	err = cur.All(todo, &res)
+	defer cur.Close(ctx)
+	err = cur.All(ctx, &res)
 	return res, err
 }
 
 // create one index by indexModel
-func (iv *indexView) CreateOne(index Index, t ...time.Duration) (id string, err error) {
+func (iv *indexView) CreateOne(ctx context.Context, index Index, t ...time.Duration) (id string, err error) {
+	ctx, view, release, err := iv.view(ctx)
+	if err != nil {
+		return
+	}
+	defer release()
+
 	opts := options.CreateIndexes()
 	if len(t) > 0 {
 		opts.SetMaxTime(t[0] * time.Second)
@@ -54,11 +68,21 @@ func (iv *indexView) CreateOne(index Index, t ...time.Duration) (id string, err
 		Options: iopts,
 	}
 
-	return iv.index.CreateOne(todo, model, opts)
+	return view.CreateOne(ctx, model, opts)
 }
 
 // creat many index by indexModels
-func (iv *indexView) CreateMany(indexs []Index, t ...time.Duration) (ids []string, err error) {
+func (iv *indexView) CreateMany(ctx context.Context, indexs []Index, t ...time.Duration) (ids []string, err error) {
+	ctx, db, release, err := iv.orm.acquire(ctx)
+	if err != nil {
+		return
+	}
+	defer release()
+	return iv.createMany(ctx, db, indexs, t...)
+}
+
+// create many indexes on the leased db, SyncDB uses the db it holds.
+func (iv *indexView) createMany(ctx context.Context, db *DB, indexs []Index, t ...time.Duration) (ids []string, err error) {
 	opts := options.CreateIndexes()
 	if len(t) > 0 {
 		opts.SetMaxTime(t[0] * time.Second)
@@ -77,52 +101,74 @@ func (iv *indexView) CreateMany(indexs []Index, t ...time.Duration) (ids []strin
 		models = append(models, model)
 	}
 
-	return iv.index.CreateMany(todo, models, opts)
+	return db.MDB.Collection(iv.table).Indexes().CreateMany(ctx, models, opts)
 }
 
 // drop one index by index name
-func (iv *indexView) DropOne(name string, t ...time.Duration) (err error) {
+func (iv *indexView) DropOne(ctx context.Context, name string, t ...time.Duration) (err error) {
+	ctx, view, release, err := iv.view(ctx)
+	if err != nil {
+		return
+	}
+	defer release()
+
 	opts := options.DropIndexes()
 	if len(t) > 0 {
 		opts.SetMaxTime(t[0] * time.Second)
 	}
 
-	_, err = iv.index.DropOne(todo, name, opts)
+	_, err = view.DropOne(ctx, name, opts)
 	return
 }
 
 // drop all index
-func (iv *indexView) DropAll(t ...time.Duration) (err error) {
+func (iv *indexView) DropAll(ctx context.Context, t ...time.Duration) (err error) {
+	ctx, view, release, err := iv.view(ctx)
+	if err != nil {
+		return
+	}
+	defer release()
+
 	opts := options.DropIndexes()
 	if len(t) > 0 {
 		opts.SetMaxTime(t[0] * time.Second)
 	}
 
-	_, err = iv.index.DropAll(todo, opts)
+	_, err = view.DropAll(ctx, opts)
 	return
 }
 
+// lease a connection for one index operation.
+func (iv *indexView) view(ctx context.Context) (_ context.Context, view mongo.IndexView, release func(), err error) {
+	ctx, db, release, err := iv.orm.acquire(ctx)
+	if err != nil {
+		return
+	}
+	return ctx, db.MDB.Collection(iv.table).Indexes(), release, nil
+}
+
 // new indexView
-func newIndexView(iv mongo.IndexView) IndexViewer {
+func newIndexView(o *orm, table string) IndexViewer {
 	v := new(indexView)
-	v.index = iv
+	v.orm = o
+	v.table = table
 	return v
 }
 
-func convertIndex(index Index) (keys bson.M, iopts *options.IndexOptions, err error) {
+// keys are kept in order, it matters for compound indexes.
+func convertIndex(index Index) (keys bson.D, iopts *options.IndexOptions, err error) {
 	if len(index.Keys) < 1 {
 		err = ErrNoIndexKey
 		return
 	}
 
-	keys = bson.M{}
+	keys = bson.D{}
 
 	for _, v := range index.Keys {
 		if v[0] == '-' {
-			v = v[1:]
-			keys[v] = -1
+			keys = append(keys, bson.E{Key: v[1:], Value: -1})
 		} else {
-			keys[v] = 1
+			keys = append(keys, bson.E{Key: v, Value: 1})
 		}
 	}
 
@@ -15,12 +15,17 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"strings"
+	"sync"
 	"time"
+
+	"go.mongodb.org/mongo-driver/event"
 )
 
 // Log implement the log.Logger
@@ -66,6 +71,39 @@ func debugLogQueies(alias *alias, operaton, query string, t time.Time, err error
 	DebugLog.Println(con)
 }
 
+// newCommandMonitor log the finished mongodb commands of the alias when Debug or the Debug of the alias is set.
+// the alias is looked up when logging, so a re-registered alias takes effect.
+func newCommandMonitor(aliasName string) *event.CommandMonitor {
+	var started sync.Map
+	debugAlias := func() *alias {
+		if al, ok := dataBaseCache.get(aliasName); ok && (Debug || al.Debug) {
+			return al
+		}
+		return nil
+	}
+	finish := func(e event.CommandFinishedEvent, err error) {
+		cmd, ok := started.LoadAndDelete(e.RequestID)
+		al := debugAlias()
+		if !ok || al == nil {
+			return
+		}
+		debugLogQueies(al, "mgo."+e.CommandName, cmd.(string), time.Now().Add(-e.Duration), err)
+	}
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			if debugAlias() != nil {
+				started.Store(e.RequestID, e.Command.String())
+			}
+		},
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			finish(e.CommandFinishedEvent, nil)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			finish(e.CommandFinishedEvent, errors.New(e.Failure))
+		},
+	}
+}
+
 // statement query logger struct.
 // if dev mode, use stmtQueryLog, or use stmtQuerier.
 type stmtQueryLog struct {
@@ -0,0 +1,303 @@
+package orm
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrPageToken = errors.New("<QuerySeter.PageAfter> invalid page token")
+)
+
+// Page is the result of Paginate and PageAfter, Items is the container of the records.
+type Page struct {
+	Items interface{}
+	// the tokens of PageAfter, they are empty when there is no such page
+	Next string
+	Prev string
+	// the page number from 1, page size, records count and pages count of Paginate
+	Number int64
+	Size   int64
+	Total  int64
+	Pages  int64
+}
+
+// HasNext check there is a next page.
+func (p *Page) HasNext() bool {
+	return p.Next != "" || p.Number < p.Pages
+}
+
+// HasPrev check there is a previous page.
+func (p *Page) HasPrev() bool {
+	return p.Prev != "" || p.Number > 1
+}
+
+// read the records of page number into container with the total count, the records are sorted by OrderBy.
+// mongodb runs a single $facet aggregation after UseFacet, otherwise Count and All are called.
+func (o *querySet) Paginate(number, size int64, container interface{}) (*Page, error) {
+	if size <= 0 {
+		return nil, ErrArgs
+	}
+	if number < 1 {
+		number = 1
+	}
+	page := &Page{Items: container, Number: number, Size: size}
+
+	qs := *o
+	qs.limit = size
+	qs.offset = (number - 1) * size
+
+	var err error
+	if o.facet {
+		page.Total, err = qs.facetPaginate(container)
+	}
+	if !o.facet || err == ErrNotImplement {
+		page.Total, err = o.Count()
+		if err == nil {
+			err = qs.All(container)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page.Pages = (page.Total + size - 1) / size
+	return page, nil
+}
+
+// read the records and total count by one $facet aggregation.
+// groups and distinct are not translated to the $facet, Count and All are used for them.
+func (o *querySet) facetPaginate(container interface{}) (int64, error) {
+	if len(o.groups) > 0 || o.distinct {
+		return 0, ErrNotImplement
+	}
+	items := []bson.D{}
+	if len(o.orders) > 0 {
+		items = append(items, bson.D{{Key: "$sort", Value: getSort(o.orders)}})
+	}
+	if o.offset > 0 {
+		items = append(items, bson.D{{Key: "$skip", Value: o.offset}})
+	}
+	items = append(items, bson.D{{Key: "$limit", Value: o.limit}})
+
+	p := newPipeline(&querySet{mi: o.mi, cond: o.cond}).Facet(map[string]Pipeliner{
+		"total": NewPipeline().Stage(bson.D{{Key: "$count", Value: "n"}}),
+		"items": &pipeline{stages: items},
+	}).(*pipeline)
+	p.qs = o
+
+	var res struct {
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+		Items bson.RawValue `bson:"items"`
+	}
+	if err := p.One(&res); err != nil {
+		return 0, err
+	}
+	if err := res.Items.Unmarshal(container); err != nil {
+		return 0, err
+	}
+	if len(res.Total) == 0 {
+		return 0, nil
+	}
+	return res.Total[0].N, nil
+}
+
+const (
+	pageNext = "n"
+	pagePrev = "p"
+)
+
+// the decoded page token, it keeps the sort key values of the last or first row of a page.
+type pageToken struct {
+	Dir    string          `bson:"d"`
+	Orders []string        `bson:"o"`
+	Values []bson.RawValue `bson:"v"`
+}
+
+// read a page of size into container after the token, the records are sorted by orders like OrderBy,
+// the primary key is appended to orders to make the sort keys unique.
+// the first page is read with an empty token, Page.Next and Page.Prev are the tokens of the following calls.
+func (o *querySet) PageAfter(container interface{}, token string, size int64, orders ...string) (*Page, error) {
+	if size <= 0 {
+		return nil, ErrArgs
+	}
+	orders = o.pageOrders(orders)
+
+	dir := pageNext
+	cond := o.cond
+	if token != "" {
+		tk, err := decodePageToken(token)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(tk.Orders, orders) {
+			return nil, fmt.Errorf("%w: orders `%v` not match `%v`", ErrPageToken, tk.Orders, orders)
+		}
+		values, err := o.pageValues(orders, tk.Values)
+		if err != nil {
+			return nil, err
+		}
+		dir = tk.Dir
+		if cond == nil {
+			cond = NewCondition()
+		}
+		cond = cond.AndCond(keysetCondition(orders, values, dir == pagePrev))
+	}
+
+	qs := *o
+	qs.cond = cond
+	qs.orders = orders
+	if dir == pagePrev {
+		qs.orders = reverseOrders(orders)
+	}
+	qs.limit = size + 1
+	qs.offset = 0
+	if err := qs.All(container); err != nil {
+		return nil, err
+	}
+
+	ind := reflect.Indirect(reflect.ValueOf(container))
+	more := int64(ind.Len()) > size
+	if more {
+		ind.Set(ind.Slice(0, int(size)))
+	}
+	if dir == pagePrev {
+		swap := reflect.Swapper(ind.Interface())
+		for i, j := 0, ind.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	page := &Page{Items: container}
+	if ind.Len() == 0 {
+		return page, nil
+	}
+	// a next page exists when more rows are read forward, or when paging backward from it, and vice versa
+	if dir == pageNext && more || dir == pagePrev {
+		page.Next = o.pageToken(pageNext, orders, ind.Index(ind.Len()-1))
+	}
+	if dir == pagePrev && more || dir == pageNext && token != "" {
+		page.Prev = o.pageToken(pagePrev, orders, ind.Index(0))
+	}
+	return page, nil
+}
+
+// get the columns of orders with the primary key appended.
+func (o *querySet) pageOrders(orders []string) []string {
+	res := make([]string, 0, len(orders)+1)
+	hasPk := false
+	for _, order := range orders {
+		desc := ""
+		if order[0] == '-' {
+			desc = "-"
+			order = order[1:]
+		}
+		fi, ok := o.mi.fields.GetByAny(order)
+		if !ok {
+			panic(fmt.Errorf("<QuerySeter.PageAfter> unknown field/column name `%s`", order))
+		}
+		if fi == o.mi.fields.pk {
+			hasPk = true
+		}
+		res = append(res, desc+fi.column)
+	}
+	if !hasPk && o.mi.fields.pk != nil {
+		res = append(res, o.mi.fields.pk.column)
+	}
+	return res
+}
+
+// decode the sort key values of the token into the types of the fields.
+func (o *querySet) pageValues(orders []string, raws []bson.RawValue) ([]interface{}, error) {
+	if len(raws) != len(orders) {
+		return nil, ErrPageToken
+	}
+	values := make([]interface{}, len(orders))
+	for i, order := range orders {
+		fi, _ := o.mi.fields.GetByAny(trimOrder(order))
+		val := reflect.New(o.mi.addrField.Elem().Type().FieldByIndex(fi.fieldIndex).Type)
+		if err := raws[i].Unmarshal(val.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrPageToken, err)
+		}
+		values[i] = val.Elem().Interface()
+	}
+	return values, nil
+}
+
+// encode the sort key values of the row into a token.
+func (o *querySet) pageToken(dir string, orders []string, row reflect.Value) string {
+	ind := reflect.Indirect(row)
+	values := make(bson.A, len(orders))
+	for i, order := range orders {
+		fi, _ := o.mi.fields.GetByAny(trimOrder(order))
+		values[i] = ind.FieldByIndex(fi.fieldIndex).Interface()
+	}
+	data, err := bson.Marshal(bson.M{"d": dir, "o": orders, "v": values})
+	if err != nil {
+		panic(fmt.Errorf("<QuerySeter.PageAfter> encode page token failed, %s", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(token string) (*pageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPageToken, err)
+	}
+	tk := new(pageToken)
+	if err = bson.Unmarshal(data, tk); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPageToken, err)
+	}
+	if tk.Dir != pageNext && tk.Dir != pagePrev {
+		return nil, ErrPageToken
+	}
+	return tk, nil
+}
+
+// get the condition of the rows after the sort key values, or before them if backward.
+// e.g. orders (-a, b) after (1, 2): a < 1 OR (a = 1 AND b > 2)
+func keysetCondition(orders []string, values []interface{}, backward bool) *Condition {
+	keyset := NewCondition()
+	for i, order := range orders {
+		c := NewCondition()
+		for j := 0; j < i; j++ {
+			c = c.And(trimOrder(orders[j]), values[j])
+		}
+		op := "__gt"
+		if (order[0] == '-') != backward {
+			op = "__lt"
+		}
+		c = c.And(trimOrder(order)+op, values[i])
+		if i == 0 {
+			keyset = keyset.AndCond(c)
+		} else {
+			keyset = keyset.OrCond(c)
+		}
+	}
+	return keyset
+}
+
+func reverseOrders(orders []string) []string {
+	res := make([]string, len(orders))
+	for i, order := range orders {
+		if order[0] == '-' {
+			res[i] = order[1:]
+		} else {
+			res[i] = "-" + order
+		}
+	}
+	return res
+}
+
+func trimOrder(order string) string {
+	if order[0] == '-' {
+		return order[1:]
+	}
+	return order
+}
@@ -0,0 +1,130 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// pageBaser count total records and read one user, Aggregate is not implemented unless facet is set.
+type pageBaser struct {
+	dbBaser
+	facet    bool
+	total    int64
+	pipeline []bson.D
+	read     *querySet
+}
+
+func (d *pageBaser) Count(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (int64, error) {
+	return d.total, nil
+}
+
+func (d *pageBaser) ReadBatch(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, container interface{}, tz *time.Location, cols []string) error {
+	d.read = qs
+	*container.(*[]*mongoUser) = []*mongoUser{{Name: "a"}}
+	return nil
+}
+
+func (d *pageBaser) Aggregate(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, pipeline []bson.D, container interface{}, one bool, tz *time.Location) error {
+	if !d.facet {
+		return ErrNotImplement
+	}
+	d.pipeline = pipeline
+	// $count outputs nothing when no record matched
+	total := bson.A{}
+	if d.total > 0 {
+		total = append(total, bson.M{"n": d.total})
+	}
+	data, err := bson.Marshal(bson.M{"total": total, "items": bson.A{bson.M{"name": "a"}}})
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, container)
+}
+
+func TestPaginate(t *testing.T) {
+	baser := &pageBaser{total: 25}
+	o := &orm{alias: &alias{DbBaser: baser}, db: &DB{isTx: true}}
+	mi := newModelInfo(reflect.ValueOf(new(mongoUser)))
+	qs := &querySet{orm: o, mi: mi, cond: NewCondition().And("age__gte", 18), orders: []string{"-age"}}
+
+	cases := []struct {
+		name     string
+		useFacet bool
+		// the backend supports $facet
+		facet bool
+		total int64
+		want  Page
+		// GroupBy or DistinctRows is used
+		grouped bool
+	}{
+		{"facet", true, true, 25, Page{Number: 2, Size: 10, Total: 25, Pages: 3}, false},
+		{"facet empty", true, true, 0, Page{Number: 2, Size: 10, Total: 0, Pages: 0}, false},
+		{"count and all", false, true, 20, Page{Number: 2, Size: 10, Total: 20, Pages: 2}, false},
+		{"clickhouse fallback", true, false, 25, Page{Number: 2, Size: 10, Total: 25, Pages: 3}, false},
+		{"groups fallback", true, true, 25, Page{Number: 2, Size: 10, Total: 25, Pages: 3}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			baser.facet = c.facet
+			baser.total = c.total
+			baser.pipeline, baser.read = nil, nil
+			q := qs
+			if c.useFacet {
+				q = q.UseFacet().(*querySet)
+			}
+			if c.grouped {
+				q = q.GroupBy("age").DistinctRows().(*querySet)
+			}
+
+			var users []*mongoUser
+			page, err := q.Paginate(2, 10, &users)
+			if err != nil {
+				t.Fatal(err)
+			}
+			items := page.Items
+			page.Items = nil
+			if !reflect.DeepEqual(*page, c.want) {
+				t.Errorf("Paginate() = %+v, want %+v", *page, c.want)
+			}
+			if items != &users || len(users) != 1 || users[0].Name != "a" {
+				t.Errorf("Paginate() items = %v", users)
+			}
+
+			if c.useFacet && c.facet && !c.grouped {
+				want := []bson.D{
+					{{Key: "$match", Value: bson.M{"age": bson.M{"$gte": 18}}}},
+					{{Key: "$facet", Value: bson.M{
+						"total": []bson.D{{{Key: "$count", Value: "n"}}},
+						"items": []bson.D{
+							{{Key: "$sort", Value: bson.D{{Key: "age", Value: -1}}}},
+							{{Key: "$skip", Value: int64(10)}},
+							{{Key: "$limit", Value: int64(10)}},
+						},
+					}}},
+					{{Key: "$limit", Value: 1}},
+				}
+				if !reflect.DeepEqual(baser.pipeline, want) {
+					t.Errorf("Paginate() pipeline = %v, want %v", baser.pipeline, want)
+				}
+				if baser.read != nil {
+					t.Error("Paginate() with $facet also read the records")
+				}
+				return
+			}
+			if baser.pipeline != nil {
+				t.Errorf("Paginate() without $facet aggregated %v", baser.pipeline)
+			}
+			if baser.read == nil || baser.read.limit != 10 || baser.read.offset != 10 || !reflect.DeepEqual(baser.read.orders, []string{"-age"}) {
+				t.Errorf("Paginate() read = %+v, want limit 10 and offset 10", baser.read)
+			}
+		})
+	}
+
+	if _, err := qs.Paginate(1, 0, &[]*mongoUser{}); err != ErrArgs {
+		t.Errorf("Paginate() size 0 err = %v, want %v", err, ErrArgs)
+	}
+}
@@ -0,0 +1,231 @@
+package orm
+
+import (
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrNoQuerySet = errors.New("<Pipeliner> pipeline is not created from QuerySeter")
+)
+
+// Accumulator define an output field of $group or $bucket.
+type Accumulator struct {
+	Field string
+	Expr  bson.M
+}
+
+func newAccumulator(field, op string, expr interface{}) Accumulator {
+	return Accumulator{Field: field, Expr: bson.M{op: expr}}
+}
+
+// AccSum sum the expr into field, e.g. AccSum("total", "$amount") or AccSum("count", 1).
+func AccSum(field string, expr interface{}) Accumulator {
+	return newAccumulator(field, "$sum", expr)
+}
+
+// AccCount count the documents into field.
+func AccCount(field string) Accumulator {
+	return newAccumulator(field, "$sum", 1)
+}
+
+// AccAvg average the expr into field.
+func AccAvg(field string, expr interface{}) Accumulator {
+	return newAccumulator(field, "$avg", expr)
+}
+
+// AccMin get the min of expr into field.
+func AccMin(field string, expr interface{}) Accumulator {
+	return newAccumulator(field, "$min", expr)
+}
+
+// AccMax get the max of expr into field.
+func AccMax(field string, expr interface{}) Accumulator {
+	return newAccumulator(field, "$max", expr)
+}
+
+// AccFirst get the expr of the first document into field.
+func AccFirst(field string, expr interface{}) Accumulator {
+	return newAccumulator(field, "$first", expr)
+}
+
+// AccLast get the expr of the last document into field.
+func AccLast(field string, expr interface{}) Accumulator {
+	return newAccumulator(field, "$last", expr)
+}
+
+// AccPush push the expr of all documents into the array field.
+func AccPush(field string, expr interface{}) Accumulator {
+	return newAccumulator(field, "$push", expr)
+}
+
+// AccAddToSet add the distinct expr of all documents into the array field.
+func AccAddToSet(field string, expr interface{}) Accumulator {
+	return newAccumulator(field, "$addToSet", expr)
+}
+
+// real aggregation pipeline struct
+type pipeline struct {
+	qs     *querySet
+	stages []bson.D
+}
+
+var _ Pipeliner = new(pipeline)
+
+// NewPipeline create a pipeline without QuerySeter, it's used as the sub pipeline of Facet.
+func NewPipeline() Pipeliner {
+	return &pipeline{}
+}
+
+// create the pipeline with the filter, orders, offset and limit of qs.
+func newPipeline(qs *querySet) *pipeline {
+	p := &pipeline{qs: qs}
+	if filter := convertCondition(qs.mi, qs.cond); len(filter) > 0 {
+		p = p.add("$match", filter)
+	}
+	if len(qs.orders) > 0 {
+		p = p.add("$sort", getSort(qs.orders))
+	}
+	if qs.offset > 0 {
+		p = p.add("$skip", qs.offset)
+	}
+	if qs.limit > 0 {
+		p = p.add("$limit", qs.limit)
+	}
+	return p
+}
+
+// return a copy with the stage appended, so a pipeline can be reused as a prefix.
+func (p pipeline) add(key string, value interface{}) *pipeline {
+	return p.Stage(bson.D{{Key: key, Value: value}}).(*pipeline)
+}
+
+// add $match stage.
+func (p pipeline) Match(cond *Condition) Pipeliner {
+	var mi *modelInfo
+	if p.qs != nil {
+		mi = p.qs.mi
+	}
+	return p.add("$match", convertCondition(mi, cond))
+}
+
+// add $project stage.
+func (p pipeline) Project(projection bson.M) Pipeliner {
+	return p.add("$project", projection)
+}
+
+// add $addFields stage.
+func (p pipeline) AddFields(fields bson.M) Pipeliner {
+	return p.add("$addFields", fields)
+}
+
+// add $group stage, id is the group key, e.g. nil, "$name" or bson.M{"y": "$year", "m": "$month"}.
+func (p pipeline) Group(id interface{}, accs ...Accumulator) Pipeliner {
+	group := bson.M{"_id": id}
+	for _, acc := range accs {
+		group[acc.Field] = acc.Expr
+	}
+	return p.add("$group", group)
+}
+
+// add $sort stage, "field" means ASC, "-field" means DESC.
+func (p pipeline) Sort(exprs ...string) Pipeliner {
+	return p.add("$sort", getSort(exprs))
+}
+
+// add $skip stage.
+func (p pipeline) Skip(n int64) Pipeliner {
+	return p.add("$skip", n)
+}
+
+// add $limit stage.
+func (p pipeline) Limit(n int64) Pipeliner {
+	return p.add("$limit", n)
+}
+
+// add $unwind stage, path is the array field, e.g. "items".
+func (p pipeline) Unwind(path string, preserveNullAndEmpty bool) Pipeliner {
+	if !strings.HasPrefix(path, "$") {
+		path = "$" + path
+	}
+	if !preserveNullAndEmpty {
+		return p.add("$unwind", path)
+	}
+	return p.add("$unwind", bson.M{"path": path, "preserveNullAndEmptyArrays": true})
+}
+
+// add $lookup stage joining the collection from.
+func (p pipeline) Lookup(from, localField, foreignField, as string) Pipeliner {
+	return p.add("$lookup", bson.M{
+		"from":         from,
+		"localField":   localField,
+		"foreignField": foreignField,
+		"as":           as,
+	})
+}
+
+// add $facet stage, each sub pipeline is created by NewPipeline.
+func (p pipeline) Facet(facets map[string]Pipeliner) Pipeliner {
+	facet := bson.M{}
+	for name, sub := range facets {
+		facet[name] = sub.Stages()
+	}
+	return p.add("$facet", facet)
+}
+
+// add $bucket stage, defaultID is omitted when nil, the output is the count of each bucket without accs.
+func (p pipeline) Bucket(groupBy interface{}, boundaries []interface{}, defaultID interface{}, accs ...Accumulator) Pipeliner {
+	bucket := bson.M{
+		"groupBy":    groupBy,
+		"boundaries": boundaries,
+	}
+	if defaultID != nil {
+		bucket["default"] = defaultID
+	}
+	if len(accs) > 0 {
+		output := bson.M{}
+		for _, acc := range accs {
+			output[acc.Field] = acc.Expr
+		}
+		bucket["output"] = output
+	}
+	return p.add("$bucket", bucket)
+}
+
+// append a raw stage.
+func (p pipeline) Stage(stage bson.D) Pipeliner {
+	stages := make([]bson.D, len(p.stages), len(p.stages)+1)
+	copy(stages, p.stages)
+	p.stages = append(stages, stage)
+	return &p
+}
+
+// get the stages of the pipeline.
+func (p *pipeline) Stages() []bson.D {
+	return p.stages
+}
+
+// run the pipeline and decode all results into container.
+func (p *pipeline) All(container interface{}) error {
+	return p.run(container, false)
+}
+
+// run the pipeline and decode the first result into container.
+func (p *pipeline) One(container interface{}) error {
+	return p.add("$limit", 1).run(container, true)
+}
+
+func (p *pipeline) run(container interface{}, one bool) error {
+	qs := p.qs
+	if qs == nil {
+		return ErrNoQuerySet
+	}
+	ctx, db, release, err := qs.orm.acquireRead(qs.context())
+	if err != nil {
+		return err
+	}
+	defer release()
+	return qs.orm.alias.DbBaser.Aggregate(ctx, db, qs, qs.mi, p.stages, container, one, qs.orm.alias.TZ)
+}
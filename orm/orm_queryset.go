@@ -17,6 +17,11 @@ package orm
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type colValue struct {
@@ -54,21 +59,45 @@ func ColValue(opt operator, value interface{}) interface{} {
 	return val
 }
 
+// AggFunc define the aggregate function of Annotation.
+type AggFunc string
+
+// define aggregate functions
+const (
+	AggSum           AggFunc = "sum"
+	AggAvg           AggFunc = "avg"
+	AggMin           AggFunc = "min"
+	AggMax           AggFunc = "max"
+	AggCount         AggFunc = "count"
+	AggCountDistinct AggFunc = "count_distinct"
+)
+
+// Annotation define an aggregate of Annotate, the result is named Name.
+// Field is the field expression like Filter, AggCount without Field counts the records.
+type Annotation struct {
+	Name  string
+	Func  AggFunc
+	Field string
+}
+
 // real query struct
 type querySet struct {
-	mi         *modelInfo
-	cond       *Condition
-	related    []string
-	relDepth   int
-	limit      int64
-	offset     int64
-	groups     []string
-	orders     []string
-	distinct   bool
-	forupdate  bool
-	orm        *orm
-	ctx        context.Context
-	forContext bool
+	mi          *modelInfo
+	cond        *Condition
+	related     []string
+	relDepth    int
+	limit       int64
+	offset      int64
+	groups      []string
+	orders      []string
+	distinct    bool
+	forupdate   bool
+	batchSize   int32
+	facet       bool
+	orm         *orm
+	ctx         context.Context
+	readPref    *readpref.ReadPref
+	readConcern *readconcern.ReadConcern
 }
 
 var _ QuerySeter = new(querySet)
@@ -134,11 +163,12 @@ func (o querySet) OrderBy(exprs ...string) QuerySeter {
 	return &o
 }
 
-// add DISTINCT to SELECT
-// func (o querySet) Distinct() QuerySeter {
-// 	o.distinct = true
-// 	return &o
-// }
+// add DISTINCT to SELECT of All and Values.
+// mongodb groups the documents by the selected fields instead.
+func (o querySet) DistinctRows() QuerySeter {
+	o.distinct = true
+	return &o
+}
 
 // add FOR UPDATE to SELECT
 func (o querySet) ForUpdate() QuerySeter {
@@ -179,23 +209,107 @@ func (o querySet) GetCond() *Condition {
 
 // return QuerySeter execution result number
 func (o *querySet) Count() (i int64, err error) {
-	return o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	ctx, db, release, err := o.orm.acquireRead(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return o.orm.alias.DbBaser.Count(ctx, db, o, o.mi, o.cond, o.orm.alias.TZ)
 }
 
 // check result empty or not after QuerySeter executed
 func (o *querySet) Exist() bool {
-	cnt, _ := o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	cnt, _ := o.Count()
 	return cnt > 0
 }
 
 // execute update with parameters
 func (o *querySet) Update(operator OperatorUpdate, values Params) (i int64, err error) {
-	return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, o, o.mi, o.cond, operator, values, o.orm.alias.TZ)
+	ctx, db, release, err := o.orm.acquire(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return o.orm.alias.DbBaser.UpdateBatch(ctx, db, o, o.mi, o.cond, operator, values, o.orm.alias.TZ)
 }
 
 // execute delete
 func (o *querySet) Delete() (i int64, err error) {
-	return o.orm.alias.DbBaser.DeleteBatch(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	ctx, db, release, err := o.orm.acquire(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return o.orm.alias.DbBaser.DeleteBatch(ctx, db, o, o.mi, o.cond, o.orm.alias.TZ)
+}
+
+// query the sum of field.
+func (o *querySet) Sum(field string) (float64, error) {
+	v, err := o.aggregate(AggSum, field)
+	return toFloat64(v), err
+}
+
+// query the average of field.
+func (o *querySet) Avg(field string) (float64, error) {
+	v, err := o.aggregate(AggAvg, field)
+	return toFloat64(v), err
+}
+
+// query the min value of field.
+func (o *querySet) Min(field string) (interface{}, error) {
+	return o.aggregate(AggMin, field)
+}
+
+// query the max value of field.
+func (o *querySet) Max(field string) (interface{}, error) {
+	return o.aggregate(AggMax, field)
+}
+
+// query the number of distinct values of field.
+func (o *querySet) CountDistinct(field string) (int64, error) {
+	v, err := o.aggregate(AggCountDistinct, field)
+	if err != nil || v == nil {
+		return 0, err
+	}
+	return ToInt64(v), nil
+}
+
+// query one aggregate of all matched records, it's nil when nothing matched.
+func (o *querySet) aggregate(fn AggFunc, field string) (interface{}, error) {
+	qs := *o
+	qs.groups = nil
+	qs.orders = nil
+	qs.limit = 0
+	qs.offset = 0
+
+	var res []Params
+	if _, err := qs.Annotate(&res, Annotation{Name: "value", Func: fn, Field: field}); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	return res[0]["value"], nil
+}
+
+// query the aggregates of each group into []Params.
+// the keys of Params are the GroupBy exprs and the annotation names,
+// which can be used by OrderBy. without GroupBy, there's one row of all matched records.
+func (o *querySet) Annotate(results *[]Params, anns ...Annotation) (int64, error) {
+	if len(anns) == 0 {
+		return 0, ErrArgs
+	}
+	ctx, db, release, err := o.orm.acquireRead(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return o.orm.alias.DbBaser.ReadAnnotates(ctx, db, o, o.mi, o.cond, anns, results, o.orm.alias.TZ)
+}
+
+// create the aggregation pipeline of mongodb.
+func (o querySet) Aggregate() Pipeliner {
+	return newPipeline(&o)
 }
 
 // get indexview
@@ -206,14 +320,24 @@ func (o *querySet) IndexView() (iv IndexViewer) {
 // query all data and map to containers.
 // cols means the columns when querying.
 func (o *querySet) All(container interface{}, cols ...string) (err error) {
-	return o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	ctx, db, release, err := o.orm.acquireRead(o.context())
+	if err != nil {
+		return err
+	}
+	defer release()
+	return o.orm.alias.DbBaser.ReadBatch(ctx, db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
 }
 
 // query one row data and map to containers.
 // cols means the columns when querying.
 func (o *querySet) One(container interface{}, cols ...string) (err error) {
 	o.limit = 1
-	err = o.orm.alias.DbBaser.FindOne(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	ctx, db, release, err := o.orm.acquireRead(o.context())
+	if err != nil {
+		return err
+	}
+	defer release()
+	err = o.orm.alias.DbBaser.FindOne(ctx, db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
 	if err != nil {
 		return err
 	}
@@ -221,27 +345,123 @@ func (o *querySet) One(container interface{}, cols ...string) (err error) {
 
 }
 
+// make Paginate of mongodb run a single $facet aggregation.
+func (o querySet) UseFacet() QuerySeter {
+	o.facet = true
+	return &o
+}
+
+// set the batch size of mongodb cursor.
+func (o querySet) BatchSize(size int32) QuerySeter {
+	o.batchSize = size
+	return &o
+}
+
+// iterate the records, stop when fn returns an error, ErrStopIteration is not returned.
+func (o *querySet) Iterate(ctx context.Context, fn func(rowPtr interface{}) error, cols ...string) (err error) {
+	qs := *o
+	qs.ctx = ctx
+	rows, err := qs.Rows(cols...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := rows.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	typ := o.mi.addrField.Elem().Type()
+	for rows.Next() {
+		ptr := reflect.New(typ).Interface()
+		if err = rows.Scan(ptr); err != nil {
+			return err
+		}
+		if err = fn(ptr); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// open the rows of the records, the connection is released by Close.
+// the QueryTimeout of the alias only bounds the query, reading the rows is bounded by the context.
+func (o *querySet) Rows(cols ...string) (RowsIterator, error) {
+	ctx, db, opened, release, err := o.orm.acquireRows(o.context())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := o.orm.alias.DbBaser.ReadRows(ctx, db, o, o.mi, o.cond, o.orm.alias.TZ, cols)
+	if !opened() {
+		if err == nil {
+			rows.Close()
+		}
+		err = context.DeadlineExceeded
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &leasedRows{RowsIterator: rows, release: release}, nil
+}
+
+// rows holding the connection lease until Close.
+type leasedRows struct {
+	RowsIterator
+	release func()
+	once    sync.Once
+}
+
+func (r *leasedRows) Close() error {
+	err := r.RowsIterator.Close()
+	r.once.Do(r.release)
+	return err
+}
+
 func (o *querySet) Distinct(field string) (res []interface{}, err error) {
-	return o.orm.alias.DbBaser.Distinct(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ, field)
+	ctx, db, release, err := o.orm.acquireRead(o.context())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return o.orm.alias.DbBaser.Distinct(ctx, db, o, o.mi, o.cond, o.orm.alias.TZ, field)
 }
 
 // query all data and map to []map[string]interface.
 // expres means condition expression.
 // it converts data to []map[column]value.
 func (o *querySet) Values(results *[]Params, exprs ...string) (i int64, err error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	ctx, db, release, err := o.orm.acquireRead(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return o.orm.alias.DbBaser.ReadValues(ctx, db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
 }
 
 // query all data and map to [][]interface
 // it converts data to [][column_index]value
 func (o *querySet) ValuesList(results *[]ParamsList, exprs ...string) (i int64, err error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	ctx, db, release, err := o.orm.acquireRead(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return o.orm.alias.DbBaser.ReadValues(ctx, db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
 }
 
 // query all data and map to []interface.
 // it's designed for one row record set, auto change to []value, not [][column]value.
 func (o *querySet) ValuesFlat(result *ParamsList, expr string) (cnt int64, err error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, []string{expr}, result, o.orm.alias.TZ)
+	ctx, db, release, err := o.orm.acquireRead(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return o.orm.alias.DbBaser.ReadValues(ctx, db, o, o.mi, o.cond, []string{expr}, result, o.orm.alias.TZ)
 }
 
 // query all rows into map[string]interface with specify key and value column name.
@@ -255,7 +475,7 @@ func (o *querySet) ValuesFlat(result *ParamsList, expr string) (cnt int64, err e
 // 	"found": 200,
 // }
 func (o *querySet) RowsToMap(result *Params, keyCol, valueCol string) (i int64, err error) {
-	panic(ErrNotImplement)
+	return o.queryRowsTo(result, keyCol, valueCol)
 }
 
 // query all rows into struct with specify key and value column name.
@@ -269,16 +489,79 @@ func (o *querySet) RowsToMap(result *Params, keyCol, valueCol string) (i int64,
 // 	Found int
 // }
 func (o *querySet) RowsToStruct(ptrStruct interface{}, keyCol, valueCol string) (int64, error) {
-	panic(ErrNotImplement)
+	return o.queryRowsTo(ptrStruct, keyCol, valueCol)
+}
+
+// query the key and value columns by ValuesList, and save to *Params or the fields of ptr struct.
+func (o *querySet) queryRowsTo(container interface{}, keyCol, valueCol string) (int64, error) {
+	var rows []ParamsList
+	cnt, err := o.ValuesList(&rows, keyCol, valueCol)
+	if err != nil {
+		return 0, err
+	}
+	o.setRowsTo(container, rows)
+	return cnt, nil
+}
+
+// save the key and value rows to *Params or the fields of ptr struct.
+// a nil key is "", the keys without a field of the struct are ignored.
+func (o *querySet) setRowsTo(container interface{}, rows []ParamsList) {
+	result, isMap := container.(*Params)
+	var ind reflect.Value
+	if !isMap {
+		vl := reflect.ValueOf(container)
+		ind = reflect.Indirect(vl)
+		if vl.Kind() != reflect.Ptr || ind.Kind() != reflect.Struct {
+			panic(fmt.Errorf("<QuerySeter> RowsTo unsupport type `%T` need ptr struct", container))
+		}
+	}
+
+	maps := make(Params, len(rows))
+	// reuse the value conversion of RawSeter
+	rs := &rawSet{orm: o.orm}
+	for _, row := range rows {
+		key := ""
+		if row[0] != nil {
+			key = ToStr(row[0])
+		}
+		if isMap {
+			maps[key] = row[1]
+		} else if field := ind.FieldByName(camelString(key)); field.IsValid() {
+			rs.setFieldValue(field, row[1])
+		}
+	}
+
+	if isMap {
+		*result = maps
+	}
 }
 
 // set context to QuerySeter.
 func (o querySet) WithContext(ctx context.Context) QuerySeter {
 	o.ctx = ctx
-	o.forContext = true
 	return &o
 }
 
+// set the read preference of mongodb, not used inside a transaction.
+func (o querySet) ReadPreference(rp *readpref.ReadPref) QuerySeter {
+	o.readPref = rp
+	return &o
+}
+
+// set the read concern of mongodb, not used inside a transaction.
+func (o querySet) ReadConcern(rc *readconcern.ReadConcern) QuerySeter {
+	o.readConcern = rc
+	return &o
+}
+
+// get the context of QuerySeter, default is todo.
+func (o *querySet) context() context.Context {
+	if o != nil && o.ctx != nil {
+		return o.ctx
+	}
+	return todo
+}
+
 // create new QuerySeter.
 func newQuerySet(orm *orm, mi *modelInfo) QuerySeter {
 	o := new(querySet)
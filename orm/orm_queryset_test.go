@@ -0,0 +1,163 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type rowsConfig struct {
+	MaxConn int
+	Name    string
+	Debug   bool
+	Rate    float64
+	Created time.Time
+}
+
+func TestSetRowsTo(t *testing.T) {
+	qs := &querySet{orm: &orm{alias: &alias{DbBaser: newdbBaseClickHouse(), TZ: time.UTC}}}
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		rows       []ParamsList
+		wantMap    Params
+		wantStruct rowsConfig
+	}{
+		{
+			name:    "empty",
+			rows:    nil,
+			wantMap: Params{},
+		},
+		{
+			name: "convert values",
+			rows: []ParamsList{
+				{"max_conn", "100"},
+				{"name", []byte("a")},
+				{"debug", int64(1)},
+				{"rate", "0.5"},
+				{"created", created},
+			},
+			wantMap: Params{
+				"max_conn": "100",
+				"name":     []byte("a"),
+				"debug":    int64(1),
+				"rate":     "0.5",
+				"created":  created,
+			},
+			wantStruct: rowsConfig{MaxConn: 100, Name: "a", Debug: true, Rate: 0.5, Created: created},
+		},
+		{
+			name:       "nil key and value",
+			rows:       []ParamsList{{nil, 1}, {"name", nil}, {"max_conn", 3}},
+			wantMap:    Params{"": 1, "name": nil, "max_conn": 3},
+			wantStruct: rowsConfig{MaxConn: 3},
+		},
+		{
+			name:       "unknown field",
+			rows:       []ParamsList{{"unknown", 1}, {"max_conn", 8}},
+			wantMap:    Params{"unknown": 1, "max_conn": 8},
+			wantStruct: rowsConfig{MaxConn: 8},
+		},
+		{
+			name:       "last row wins",
+			rows:       []ParamsList{{"max_conn", 1}, {"max_conn", 2}},
+			wantMap:    Params{"max_conn": 2},
+			wantStruct: rowsConfig{MaxConn: 2},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var m Params
+			qs.setRowsTo(&m, c.rows)
+			if !reflect.DeepEqual(m, c.wantMap) {
+				t.Errorf("RowsToMap() = %v, want %v", m, c.wantMap)
+			}
+
+			var s rowsConfig
+			qs.setRowsTo(&s, c.rows)
+			if !reflect.DeepEqual(s, c.wantStruct) {
+				t.Errorf("RowsToStruct() = %+v, want %+v", s, c.wantStruct)
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RowsToStruct() of a non struct pointer should panic")
+		}
+	}()
+	qs.setRowsTo(rowsConfig{}, nil)
+}
+
+// rowsBaser open the rows after delay, the rows keep the context to check it later.
+type rowsBaser struct {
+	dbBaser
+	delay time.Duration
+	last  *ctxRows
+}
+
+type ctxRows struct {
+	ctx    context.Context
+	closed bool
+}
+
+func (r *ctxRows) Next() bool             { return r.ctx.Err() == nil }
+func (r *ctxRows) Scan(interface{}) error { return nil }
+func (r *ctxRows) Err() error             { return r.ctx.Err() }
+func (r *ctxRows) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (d *rowsBaser) ReadRows(ctx context.Context, q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, cols []string) (RowsIterator, error) {
+	rows := &ctxRows{ctx: ctx}
+	d.last = rows
+	time.Sleep(d.delay)
+	return rows, nil
+}
+
+func TestRowsTimeout(t *testing.T) {
+	baser := &rowsBaser{}
+	o := &orm{alias: &alias{DbBaser: baser, QueryTimeout: 20 * time.Millisecond}, db: &DB{isTx: true}}
+	qs := &querySet{orm: o}
+
+	// reading the rows outlives QueryTimeout
+	rows, err := qs.Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !rows.Next() {
+		t.Errorf("rows stopped by QueryTimeout: %v", rows.Err())
+	}
+	rows.Close()
+	if rows.Next() {
+		t.Error("rows not stopped by Close")
+	}
+
+	// opening the rows is bounded by QueryTimeout
+	baser.delay = 50 * time.Millisecond
+	if _, err = qs.Rows(); err != context.DeadlineExceeded {
+		t.Errorf("Rows() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !baser.last.closed {
+		t.Error("rows opened after the timeout are not closed")
+	}
+
+	// the deadline of ctx replaces QueryTimeout, reading the rows too
+	baser.delay = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	rows, err = qs.WithContext(ctx).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	time.Sleep(50 * time.Millisecond)
+	if rows.Next() {
+		t.Error("rows not stopped by the deadline of ctx")
+	}
+}
@@ -15,6 +15,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -23,9 +24,10 @@ import (
 
 // raw sql string prepared statement
 type rawPrepare struct {
-	rs     *rawSet
-	stmt   stmtQuerier
-	closed bool
+	rs      *rawSet
+	stmt    stmtQuerier
+	release func()
+	closed  bool
 }
 
 func (o *rawPrepare) Exec(args ...interface{}) (sql.Result, error) {
@@ -35,8 +37,13 @@ func (o *rawPrepare) Exec(args ...interface{}) (sql.Result, error) {
 	return o.stmt.Exec(args...)
 }
 
+// close the statement and give its connection back to the pool.
 func (o *rawPrepare) Close() error {
+	if o.closed {
+		return ErrStmtClosed
+	}
 	o.closed = true
+	defer o.release()
 	return o.stmt.Close()
 }
 
@@ -47,11 +54,18 @@ func newRawPreparer(rs *rawSet) (RawPreparer, error) {
 	query := rs.query
 	rs.orm.alias.DbBaser.ReplaceMarks(&query)
 
-	st, err := rs.orm.db.Prepare(query)
+	// the connection is held until the preparer is closed
+	ctx, db, release, err := rs.orm.acquire(rs.context())
+	if err != nil {
+		return nil, err
+	}
+	st, err := db.PrepareContext(ctx, query)
 	if err != nil {
+		release()
 		return nil, err
 	}
-	if Debug {
+	o.release = release
+	if Debug || rs.orm.alias.Debug {
 		o.stmt = newStmtQueryLog(rs.orm.alias, st, query)
 	} else {
 		o.stmt = st
@@ -64,6 +78,7 @@ type rawSet struct {
 	query string
 	args  []interface{}
 	orm   *orm
+	ctx   context.Context
 }
 
 var _ RawSeter = new(rawSet)
@@ -74,13 +89,31 @@ func (o rawSet) SetArgs(args ...interface{}) RawSeter {
 	return &o
 }
 
+// set context for every query
+func (o rawSet) WithContext(ctx context.Context) RawSeter {
+	o.ctx = ctx
+	return &o
+}
+
+func (o *rawSet) context() context.Context {
+	if o.ctx != nil {
+		return o.ctx
+	}
+	return todo
+}
+
 // execute raw sql and return sql.Result
 func (o *rawSet) Exec() (sql.Result, error) {
 	query := o.query
 	o.orm.alias.DbBaser.ReplaceMarks(&query)
 
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
-	return o.orm.db.Exec(query, args...)
+	ctx, db, release, err := o.orm.acquire(o.context())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return db.ExecContext(ctx, query, args...)
 }
 
 // set field value to row container
@@ -319,7 +352,13 @@ func (o *rawSet) QueryRow(containers ...interface{}) error {
 	o.orm.alias.DbBaser.ReplaceMarks(&query)
 
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
-	rows, err := o.orm.db.Query(query, args...)
+	ctx, db, release, err := o.orm.acquire(o.context())
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ErrNoRows
@@ -378,7 +417,7 @@ func (o *rawSet) QueryRow(containers ...interface{}) error {
 					_, tags := parseStructTag(fe.Tag.Get(defaultStructTagName))
 					var col string
 					if col = tags["column"]; col == "" {
-						col = nameStrategyMap[nameStrategy](fe.Name)
+						col = nameStrategyMap[o.orm.alias.nameStrategy()](fe.Name)
 					}
 					if v, ok := columnsMp[col]; ok {
 						value := reflect.ValueOf(v).Elem().Interface()
@@ -452,7 +491,13 @@ func (o *rawSet) QueryRows(containers ...interface{}) (int64, error) {
 	o.orm.alias.DbBaser.ReplaceMarks(&query)
 
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
-	rows, err := o.orm.db.Query(query, args...)
+	ctx, db, release, err := o.orm.acquire(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -529,7 +574,7 @@ func (o *rawSet) QueryRows(containers ...interface{}) (int64, error) {
 						_, tags := parseStructTag(fe.Tag.Get(defaultStructTagName))
 						var col string
 						if col = tags["column"]; col == "" {
-							col = nameStrategyMap[nameStrategy](fe.Name)
+							col = nameStrategyMap[o.orm.alias.nameStrategy()](fe.Name)
 						}
 						if v, ok := columnsMp[col]; ok {
 							value := reflect.ValueOf(v).Elem().Interface()
@@ -598,8 +643,13 @@ func (o *rawSet) readValues(container interface{}, needCols []string) (int64, er
 
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
 
-	var rs *sql.Rows
-	rs, err := o.orm.db.Query(query, args...)
+	ctx, db, release, err := o.orm.acquire(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	rs, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -725,7 +775,13 @@ func (o *rawSet) queryRowsTo(container interface{}, keyCol, valueCol string) (in
 
 	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
 
-	rs, err := o.orm.db.Query(query, args...)
+	ctx, db, release, err := o.orm.acquire(o.context())
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	rs, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,43 @@
+package orm
+
+// SyncOptions define the options of SyncDBWithOptions.
+type SyncOptions struct {
+	// drop the tables or collections first
+	Force bool
+	// print the executed statements
+	Verbose bool
+	// print the plan only, nothing is changed
+	DryRun bool
+	// install the $jsonSchema validator derived from the struct fields on mongodb collections
+	Validator bool
+}
+
+// SyncDB create the tables of all registered models on the database alias, and add the columns
+// missing in the existing tables. force drop the tables first, verbose print the executed statements.
+func SyncDB(aliasName string, force, verbose bool) error {
+	return SyncDBWithOptions(aliasName, SyncOptions{Force: force, Verbose: verbose})
+}
+
+// SyncDBWithOptions sync all registered models to the database alias.
+// clickhouse tables are created or the missing columns are added, mongodb collections
+// are created with the optional validator, and the indexes declared by the models are built.
+func SyncDBWithOptions(aliasName string, opts SyncOptions) error {
+	BootStrap()
+	o := new(orm)
+	if err := o.Using(aliasName); err != nil {
+		return err
+	}
+	ctx, db, release, err := o.acquire(todo)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	for _, mi := range modelCache.allOrdered() {
+		qs := newQuerySet(o, mi).(*querySet)
+		if err = o.alias.DbBaser.SyncTable(ctx, db, qs, mi, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package orm
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+func TestTxLease(t *testing.T) {
+	wc := writeconcern.New(writeconcern.WMajority())
+	tx := &DB{isTx: true, writeConcern: wc}
+	o := &orm{alias: &alias{}, db: tx, writeConcern: wc}
+
+	_, db, release, err := o.MutationWait(MutationPoll).(*orm).acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	release()
+	if db.mutationWait != MutationPoll || !db.isTx || db.writeConcern != wc {
+		t.Errorf("acquire() = %+v, want the tx db with MutationPoll", db)
+	}
+	if tx.mutationWait != MutationAsync {
+		t.Errorf("mutationWait of the tx db = %v, want it unchanged", tx.mutationWait)
+	}
+
+	_, _, _, err = o.WriteConcern(writeconcern.New(writeconcern.W(1))).(*orm).acquire(context.Background())
+	if err != ErrTxWriteConcern {
+		t.Errorf("acquire() error = %v, want ErrTxWriteConcern", err)
+	}
+}
+
+func TestTxCommitThroughCopy(t *testing.T) {
+	o := &orm{alias: &alias{}, db: &DB{isTx: true, RWMutex: new(sync.RWMutex)}}
+	c := o.MutationWait(MutationPoll)
+
+	if err := c.Commit(); err != nil {
+		t.Fatalf("Commit() of the copy error = %v", err)
+	}
+	if o.isTx() {
+		t.Error("the transaction is still running on the Ormer of the copy")
+	}
+	if err := o.Commit(); err != ErrTxDone {
+		t.Errorf("Commit() after the copy committed err = %v, want ErrTxDone", err)
+	}
+	if err := o.WriteConcern(writeconcern.New(writeconcern.W(1))).Rollback(); err != ErrTxDone {
+		t.Errorf("Rollback() after the copy committed err = %v, want ErrTxDone", err)
+	}
+}
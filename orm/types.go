@@ -19,6 +19,11 @@ import (
 	"database/sql"
 	"reflect"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 // Fielder define field info
@@ -32,21 +37,72 @@ type Fielder interface {
 // Ormer define the orm interface
 type Ormer interface {
 	Read(interface{}, ...string) error
+	ReadWithCtx(context.Context, interface{}, ...string) error
 	ReadOrCreate(interface{}, string, ...string) (bool, interface{}, error)
+	ReadOrCreateWithCtx(context.Context, interface{}, string, ...string) (bool, interface{}, error)
 	Insert(interface{}) (interface{}, error)
+	InsertWithCtx(context.Context, interface{}) (interface{}, error)
 	InsertMulti(int, interface{}) (interface{}, error)
+	InsertMultiWithCtx(context.Context, int, interface{}) (interface{}, error)
 	// InsertOrUpdate(md interface{}, colConflitAndArgs ...string) (int64, error)
 	Update(interface{}, ...string) (interface{}, error)
+	UpdateWithCtx(context.Context, interface{}, ...string) (interface{}, error)
 	Delete(interface{}, ...string) (interface{}, error)
+	DeleteWithCtx(context.Context, interface{}, ...string) (interface{}, error)
 
 	QueryTable(interface{}) QuerySeter
 
 	Begin() error
+	BeginWithCtx(context.Context) error
 	Commit() error
 	Rollback() error
+	// DoTx run the task in a transaction, commit on nil and rollback on error or panic.
+	// for example:
+	//	err := o.DoTx(ctx, func(ctx context.Context, txOrm TxOrmer) error {
+	//		_, err := txOrm.Insert(&bill)
+	//		return err
+	//	})
+	DoTx(context.Context, func(ctx context.Context, txOrm TxOrmer) error) error
 	Using(string) error
+	// return a copy whose QuerySeter reads go to the primary instead of a replica
+	UsePrimary() Ormer
+	// return a copy whose mongodb writes use the write concern, e.g. writeconcern.New(writeconcern.WMajority(), writeconcern.J(true)),
+	// a transaction begun by the copy commits with it, changing it after Begin returns ErrTxWriteConcern
+	WriteConcern(*writeconcern.WriteConcern) Ormer
+	// return a copy whose clickhouse Update waits for the mutation, e.g. MutationSync, MutationPoll
+	MutationWait(MutationWait) Ormer
 
-	RawDB() interface{}
+	// return *mongo.Database or *sql.DB, release must be called when it's no longer used, e.g.
+	//	db, release, err := o.RawDB()
+	//	if err != nil {
+	//		return err
+	//	}
+	//	defer release()
+	RawDB() (interface{}, func(), error)
+
+	Raw(query string, args ...interface{}) RawSeter
+}
+
+// TxOrmer define the orm interface usable inside Ormer.DoTx,
+// the transaction itself is committed or rolled back by DoTx.
+type TxOrmer interface {
+	Read(interface{}, ...string) error
+	ReadWithCtx(context.Context, interface{}, ...string) error
+	ReadOrCreate(interface{}, string, ...string) (bool, interface{}, error)
+	ReadOrCreateWithCtx(context.Context, interface{}, string, ...string) (bool, interface{}, error)
+	Insert(interface{}) (interface{}, error)
+	InsertWithCtx(context.Context, interface{}) (interface{}, error)
+	InsertMulti(int, interface{}) (interface{}, error)
+	InsertMultiWithCtx(context.Context, int, interface{}) (interface{}, error)
+	Update(interface{}, ...string) (interface{}, error)
+	UpdateWithCtx(context.Context, interface{}, ...string) (interface{}, error)
+	Delete(interface{}, ...string) (interface{}, error)
+	DeleteWithCtx(context.Context, interface{}, ...string) (interface{}, error)
+
+	QueryTable(interface{}) QuerySeter
+
+	// return the *mongo.Database or *sql.DB of the transaction, release does nothing
+	RawDB() (interface{}, func(), error)
 
 	Raw(query string, args ...interface{}) RawSeter
 }
@@ -61,6 +117,8 @@ type QuerySeter interface {
 	Offset(interface{}) QuerySeter
 	GroupBy(...string) QuerySeter
 	OrderBy(...string) QuerySeter
+	// return distinct rows of All and Values, e.g. qs.DistinctRows().Values(&maps, "city")
+	DistinctRows() QuerySeter
 	RelatedSel(...interface{}) QuerySeter
 	ForUpdate() QuerySeter
 	Count() (int64, error)
@@ -69,27 +127,134 @@ type QuerySeter interface {
 	Delete() (int64, error)
 	All(interface{}, ...string) error
 	One(interface{}, ...string) error
+	// set the number of documents of each batch fetched by mongodb cursor, clickhouse streams the rows anyway.
+	BatchSize(int32) QuerySeter
+	// iterate the records one by one without loading all of them, rowPtr is a new pointer of the model.
+	// return ErrStopIteration in fn to stop early, Iterate returns nil then.
+	// for example:
+	//	err := qs.Iterate(ctx, func(rowPtr interface{}) error {
+	//		log := rowPtr.(*Log)
+	//		if log.Level == "fatal" {
+	//			return orm.ErrStopIteration
+	//		}
+	//		return nil
+	//	})
+	Iterate(ctx context.Context, fn func(rowPtr interface{}) error, cols ...string) error
+	// open the rows of the records, the connection is held until Close.
+	// QueryTimeout of the alias only bounds opening the rows, use a ctx with deadline to bound reading them.
+	// for example:
+	//	rows, err := qs.Rows()
+	//	defer rows.Close()
+	//	for rows.Next() {
+	//		var log Log
+	//		err = rows.Scan(&log)
+	//	}
+	//	err = rows.Err()
+	Rows(cols ...string) (RowsIterator, error)
 	Distinct(string) ([]interface{}, error)
+	// read a page of records after the token without OFFSET, sorted by the orders like OrderBy.
+	// for example:
+	//	var logs []*Log
+	//	page, err := qs.PageAfter(&logs, "", 20, "-Time")
+	//	// the next page
+	//	page, err = qs.PageAfter(&logs, page.Next, 20, "-Time")
+	PageAfter(container interface{}, token string, size int64, orders ...string) (*Page, error)
+	// read the records of page number (from 1) with the total count.
+	// for example:
+	//	var users []*User
+	//	page, err := qs.OrderBy("-Created").UseFacet().Paginate(2, 20, &users)
+	//	// page.Total, page.Pages, page.HasNext()
+	Paginate(number, size int64, container interface{}) (*Page, error)
+	// make Paginate of mongodb run a single $facet aggregation instead of Count and All, ignored by clickhouse,
+	// and with GroupBy or DistinctRows.
+	UseFacet() QuerySeter
 	Values(*[]Params, ...string) (int64, error)
 	ValuesList(*[]ParamsList, ...string) (int64, error)
 	ValuesFlat(*ParamsList, string) (int64, error)
 	RowsToMap(result *Params, keyCol, valueCol string) (int64, error)
 	RowsToStruct(ptrStruct interface{}, keyCol, valueCol string) (int64, error)
+	// aggregate the field of all matched records, GroupBy, OrderBy, Limit and Offset are ignored.
+	// Min and Max keep the type of the field, they are nil when nothing matched.
+	Sum(string) (float64, error)
+	Avg(string) (float64, error)
+	Min(string) (interface{}, error)
+	Max(string) (interface{}, error)
+	CountDistinct(string) (int64, error)
+	// query the aggregates of each group into []Params.
+	// without GroupBy there's one row even if nothing matched, the counts are 0 and the others nil.
+	// for example:
+	//	var res []Params
+	//	num, err := qs.GroupBy("city").OrderBy("-total").Annotate(&res,
+	//		Annotation{Name: "total", Func: AggSum, Field: "amount"},
+	//		Annotation{Name: "num", Func: AggCount},
+	//	)
+	//	// res => []Params{{"city": "hz", "total": 300, "num": 2}, ...}
+	Annotate(*[]Params, ...Annotation) (int64, error)
+	// set context, it's used by the following operations of QuerySeter.
+	WithContext(context.Context) QuerySeter
+	// set the read preference of mongodb, e.g. readpref.SecondaryPreferred()
+	ReadPreference(*readpref.ReadPref) QuerySeter
+	// set the read concern of mongodb, e.g. readconcern.Majority()
+	ReadConcern(*readconcern.ReadConcern) QuerySeter
+	// create a mongodb aggregation pipeline starting with the filter, orders, offset and limit of QuerySeter.
+	// for example:
+	//	var res []struct {
+	//		Name  string `bson:"_id"`
+	//		Total int64  `bson:"total"`
+	//	}
+	//	err := qs.Filter("status", 1).Aggregate().
+	//		Group("$name", AccSum("total", "$amount")).
+	//		Sort("-total").Limit(10).All(&res)
+	Aggregate() Pipeliner
 
 	IndexView() IndexViewer
 }
 
+// RowsIterator define the rows of QuerySeter.Rows.
+// Scan of mongodb decodes into any pointer, clickhouse needs a pointer of the model.
+type RowsIterator interface {
+	Next() bool
+	Scan(interface{}) error
+	Err() error
+	Close() error
+}
+
+// Pipeliner define the mongodb aggregation pipeline builder,
+// stages are appended in the calling order.
+type Pipeliner interface {
+	Match(*Condition) Pipeliner
+	Project(bson.M) Pipeliner
+	AddFields(bson.M) Pipeliner
+	Group(id interface{}, accs ...Accumulator) Pipeliner
+	Sort(...string) Pipeliner
+	Skip(int64) Pipeliner
+	Limit(int64) Pipeliner
+	Unwind(path string, preserveNullAndEmpty bool) Pipeliner
+	Lookup(from, localField, foreignField, as string) Pipeliner
+	Facet(map[string]Pipeliner) Pipeliner
+	Bucket(groupBy interface{}, boundaries []interface{}, defaultID interface{}, accs ...Accumulator) Pipeliner
+	// append a raw stage, e.g. bson.D{{Key: "$sample", Value: bson.M{"size": 10}}}
+	Stage(bson.D) Pipeliner
+	// get the stages of the pipeline
+	Stages() []bson.D
+	// decode all results into a pointer of slice
+	All(interface{}) error
+	// decode the first result, ErrNoDocuments when nothing matched
+	One(interface{}) error
+}
+
 type IndexViewer interface {
-	List() (interface{}, error)
-	CreateOne(Index, ...time.Duration) (string, error)
-	CreateMany([]Index, ...time.Duration) ([]string, error)
+	List(context.Context) (interface{}, error)
+	CreateOne(context.Context, Index, ...time.Duration) (string, error)
+	CreateMany(context.Context, []Index, ...time.Duration) ([]string, error)
 
-	DropOne(string, ...time.Duration) error
-	DropAll(...time.Duration) error
+	DropOne(context.Context, string, ...time.Duration) error
+	DropAll(context.Context, ...time.Duration) error
 }
 
 type dbQuerier interface {
 	Begin() error
+	BeginTx(ctx context.Context) error
 	Commit() error
 	Rollback() error
 
@@ -105,22 +270,26 @@ type dbQuerier interface {
 
 // base database struct
 type dbBaser interface {
-	Read(dbQuerier, *modelInfo, reflect.Value, interface{}, *time.Location, []string, bool) error
-	InsertOne(dbQuerier, *modelInfo, reflect.Value, interface{}, *time.Location) (interface{}, error)
-	InsertMulti(dbQuerier, *modelInfo, reflect.Value, int, interface{}, *time.Location) (interface{}, error)
-	Update(dbQuerier, *modelInfo, reflect.Value, *time.Location, []string) (interface{}, error)
-	Delete(dbQuerier, *modelInfo, reflect.Value, *time.Location, []string) (interface{}, error)
-
-	FindOne(dbQuerier, *querySet, *modelInfo, *Condition, interface{}, *time.Location, []string) error
-	Distinct(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location, string) ([]interface{}, error)
-	ReadBatch(dbQuerier, *querySet, *modelInfo, *Condition, interface{}, *time.Location, []string) error
-	Count(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location) (int64, error)
-	UpdateBatch(dbQuerier, *querySet, *modelInfo, *Condition, OperatorUpdate, Params, *time.Location) (int64, error)
-	DeleteBatch(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location) (int64, error)
+	Read(context.Context, dbQuerier, *modelInfo, reflect.Value, interface{}, *time.Location, []string, bool) error
+	InsertOne(context.Context, dbQuerier, *modelInfo, reflect.Value, interface{}, *time.Location) (interface{}, error)
+	InsertMulti(context.Context, dbQuerier, *modelInfo, reflect.Value, int, interface{}, *time.Location) (interface{}, error)
+	Update(context.Context, dbQuerier, *modelInfo, reflect.Value, *time.Location, []string) (interface{}, error)
+	Delete(context.Context, dbQuerier, *modelInfo, reflect.Value, *time.Location, []string) (interface{}, error)
+
+	FindOne(context.Context, dbQuerier, *querySet, *modelInfo, *Condition, interface{}, *time.Location, []string) error
+	Distinct(context.Context, dbQuerier, *querySet, *modelInfo, *Condition, *time.Location, string) ([]interface{}, error)
+	ReadBatch(context.Context, dbQuerier, *querySet, *modelInfo, *Condition, interface{}, *time.Location, []string) error
+	Count(context.Context, dbQuerier, *querySet, *modelInfo, *Condition, *time.Location) (int64, error)
+	UpdateBatch(context.Context, dbQuerier, *querySet, *modelInfo, *Condition, OperatorUpdate, Params, *time.Location) (int64, error)
+	DeleteBatch(context.Context, dbQuerier, *querySet, *modelInfo, *Condition, *time.Location) (int64, error)
 	Indexes(*querySet, *modelInfo, *time.Location) IndexViewer
 	TimeFromDB(*time.Time, *time.Location)
 	TimeToDB(*time.Time, *time.Location)
-	ReadValues(dbQuerier, *querySet, *modelInfo, *Condition, []string, interface{}, *time.Location) (int64, error)
+	ReadValues(context.Context, dbQuerier, *querySet, *modelInfo, *Condition, []string, interface{}, *time.Location) (int64, error)
+	Aggregate(context.Context, dbQuerier, *querySet, *modelInfo, []bson.D, interface{}, bool, *time.Location) error
+	ReadAnnotates(context.Context, dbQuerier, *querySet, *modelInfo, *Condition, []Annotation, *[]Params, *time.Location) (int64, error)
+	ReadRows(context.Context, dbQuerier, *querySet, *modelInfo, *Condition, *time.Location, []string) (RowsIterator, error)
+	SyncTable(context.Context, dbQuerier, *querySet, *modelInfo, SyncOptions) error
 	SupportUpdateJoin() bool
 	MaxLimit() uint64
 	TableQuote() string
@@ -158,6 +327,8 @@ type RawSeter interface {
 	//	num, err = dORM.Raw(query).QueryRows(&ids,&names) // ids=>{1,2},names=>{"nobody","slene"}
 	QueryRows(containers ...interface{}) (int64, error)
 	SetArgs(...interface{}) RawSeter
+	// set context, it's used by the following operations of RawSeter.
+	WithContext(context.Context) RawSeter
 	// query data to []map[string]interface
 	// see QuerySeter's Values
 	Values(container *[]Params, cols ...string) (int64, error)
@@ -51,12 +51,12 @@ func (f *StrTo) Set(v string) {
 
 // Clear string
 func (f *StrTo) Clear() {
-	*f = StrTo(0x1E)
+	*f = StrTo(rune(0x1E))
 }
 
 // Exist check string exist
 func (f StrTo) Exist() bool {
-	return string(f) != string(0x1E)
+	return string(f) != string(rune(0x1E))
 }
 
 // Bool string to bool
@@ -212,6 +212,15 @@ func ToInt64(value interface{}) (d int64) {
 	return
 }
 
+// convert the numeric value of an aggregate to float64, nil is 0
+func toFloat64(value interface{}) float64 {
+	if value == nil {
+		return 0
+	}
+	f, _ := StrTo(ToStr(value)).Float64()
+	return f
+}
+
 func snakeStringWithAcronym(s string) string {
 	data := make([]byte, 0, len(s)*2)
 	num := len(s)
@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -13,24 +14,64 @@ type Config struct {
 	InitialCap int
 	//连接池中拥有的最大的连接数
 	MaxCap int
-	//生成连接的方法
+	//生成连接的方法，连接需要能作为 map 的 key，一般为指针
 	Factory func() (interface{}, error)
 	//关闭连接的方法
 	Close func(interface{}) error
-	//检查连接是否有效的方法
-	Ping func(interface{}) error
-	//连接最大空闲时间，超过该事件则将失效
+	//检查连接是否有效的方法，ctx 在超时或连接池释放时结束
+	Ping func(context.Context, interface{}) error
+	//连接最大空闲时间，超过后关闭超出 InitialCap 的空闲连接
 	IdleTimeout time.Duration
+	//连接数达到 MaxCap 时等待空闲连接的最长时间，0 表示一直等待直到 ctx 结束
+	WaitTimeout time.Duration
+	//连接最长存活时间，超过后不再复用，0 表示不限制
+	MaxLifetime time.Duration
+	//后台维护的间隔，关闭空闲超时和超过存活时间的连接，并补足 InitialCap，0 表示不维护
+	MaintainInterval time.Duration
+	//后台 ping 空闲连接的间隔，0 表示不检查
+	HealthCheckInterval time.Duration
+}
+
+// PoolStats 连接池统计信息
+type PoolStats struct {
+	//累计新建的连接数
+	Created int64
+	//正在使用的连接数
+	InUse int
+	//空闲的连接数
+	Idle int
+	//连接数达到上限后等待的次数
+	WaitCount int64
+	//等待的总时长
+	WaitDuration time.Duration
+	//因空闲超时关闭的连接数
+	IdleClosed int64
+	//因超过存活时间关闭的连接数
+	LifetimeClosed int64
+	//ping 失败关闭的连接数
+	PingFailures int64
+	//新建连接失败的次数
+	FactoryErrors int64
 }
 
 // channelPool 存放连接信息
 type channelPool struct {
-	mu          sync.Mutex
-	conns       chan *idleConn
-	factory     func() (interface{}, error)
-	close       func(interface{}) error
-	ping        func(interface{}) error
-	idleTimeout time.Duration
+	mu                  sync.Mutex
+	conns               chan *idleConn
+	slots               chan struct{}
+	opened              map[interface{}]time.Time
+	stats               PoolStats
+	factory             func() (interface{}, error)
+	close               func(interface{}) error
+	ping                func(context.Context, interface{}) error
+	initialCap          int
+	idleTimeout         time.Duration
+	waitTimeout         time.Duration
+	maxLifetime         time.Duration
+	maintainInterval    time.Duration
+	healthCheckInterval time.Duration
+	done                chan struct{}
+	wg                  sync.WaitGroup
 }
 
 type idleConn struct {
@@ -51,10 +92,18 @@ func NewChannelPool(poolConfig *Config) (Pool, error) {
 	}
 
 	c := &channelPool{
-		conns:       make(chan *idleConn, poolConfig.MaxCap),
-		factory:     poolConfig.Factory,
-		close:       poolConfig.Close,
-		idleTimeout: poolConfig.IdleTimeout,
+		conns:               make(chan *idleConn, poolConfig.MaxCap),
+		slots:               make(chan struct{}, poolConfig.MaxCap),
+		opened:              make(map[interface{}]time.Time),
+		factory:             poolConfig.Factory,
+		close:               poolConfig.Close,
+		initialCap:          poolConfig.InitialCap,
+		idleTimeout:         poolConfig.IdleTimeout,
+		waitTimeout:         poolConfig.WaitTimeout,
+		maxLifetime:         poolConfig.MaxLifetime,
+		maintainInterval:    poolConfig.MaintainInterval,
+		healthCheckInterval: poolConfig.HealthCheckInterval,
+		done:                make(chan struct{}),
 	}
 
 	if poolConfig.Ping != nil {
@@ -62,14 +111,20 @@ func NewChannelPool(poolConfig *Config) (Pool, error) {
 	}
 
 	for i := 0; i < poolConfig.InitialCap; i++ {
-		conn, err := c.factory()
+		c.slots <- struct{}{}
+		conn, err := c.open()
 		if err != nil {
 			c.Release()
-			return nil, errors.New("factory is not able to fill the pool: " + err.Error())
+			return nil, fmt.Errorf("factory is not able to fill the pool: %w", err)
 		}
 		c.conns <- &idleConn{conn: conn, t: time.Now()}
 	}
 
+	if c.maintainInterval > 0 || c.healthCheckInterval > 0 {
+		c.wg.Add(1)
+		go c.maintain()
+	}
+
 	return c, nil
 }
 
@@ -81,114 +136,239 @@ func (c *channelPool) getConns() chan *idleConn {
 	return conns
 }
 
-// Get 从pool中取一个连接
-func (c *channelPool) Get() (interface{}, error) {
+// Get 从pool中取一个连接，连接数达到 MaxCap 时等待其他连接归还，
+// 超过 WaitTimeout 返回 ErrWaitTimeout，ctx 结束返回 ctx.Err()
+func (c *channelPool) Get(ctx context.Context) (interface{}, error) {
 	conns := c.getConns()
 	if conns == nil {
 		return nil, ErrClosed
 	}
+
+	var (
+		wait    <-chan time.Time
+		waiting bool
+	)
+	if c.waitTimeout > 0 {
+		timer := time.NewTimer(c.waitTimeout)
+		defer timer.Stop()
+		wait = timer.C
+	}
+
 	for {
+		// 优先使用空闲连接，其次在未达到 MaxCap 时新建连接
 		select {
 		case wrapConn := <-conns:
 			if wrapConn == nil {
 				return nil, ErrClosed
 			}
-			//判断是否超时，超时则丢弃
-			if timeout := c.idleTimeout; timeout > 0 {
-				if wrapConn.t.Add(timeout).Before(time.Now()) {
-					//丢弃并关闭该连接
-					c.Close(wrapConn.conn)
-					continue
-				}
-			}
-			//判断是否失效，失效则丢弃，如果用户没有设定 ping 方法，就不检查
-			if c.ping != nil {
-				if err := c.Ping(wrapConn.conn); err != nil {
-					fmt.Println("conn is not able to be connected: ", err)
-					continue
-				}
+			if c.checkIdle(ctx, wrapConn) {
+				return wrapConn.conn, nil
 			}
-			return wrapConn.conn, nil
+			continue
 		default:
-			c.mu.Lock()
-			if c.factory == nil {
-				c.mu.Unlock()
-				continue
+		}
+
+		select {
+		case c.slots <- struct{}{}:
+			return c.open()
+		default:
+		}
+
+		if !waiting {
+			waiting = true
+			defer c.addWait(time.Now())
+		}
+		select {
+		case wrapConn := <-conns:
+			if wrapConn == nil {
+				return nil, ErrClosed
 			}
-			conn, err := c.factory()
-			c.mu.Unlock()
-			if err != nil {
-				return nil, err
+			if c.checkIdle(ctx, wrapConn) {
+				return wrapConn.conn, nil
 			}
+		case c.slots <- struct{}{}:
+			return c.open()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wait:
+			return nil, ErrWaitTimeout
+		}
+	}
+}
 
-			return conn, nil
+// checkIdle 检查空闲连接是否可用，不可用的连接会被关闭
+func (c *channelPool) checkIdle(ctx context.Context, wrapConn *idleConn) bool {
+	if c.closeExpired(wrapConn) {
+		return false
+	}
+	//判断是否失效，失效则丢弃，如果用户没有设定 ping 方法，就不检查
+	if c.ping != nil {
+		if err := c.Ping(ctx, wrapConn.conn); err != nil {
+			c.mu.Lock()
+			c.stats.PingFailures++
+			c.mu.Unlock()
+			c.Close(wrapConn.conn)
+			return false
 		}
 	}
+	return true
+}
+
+// closeExpired 关闭空闲超时或超过存活时间的连接，空闲超时只关闭超出 InitialCap 的连接，
+// 保留的连接由健康检查确认可用，避免空闲时反复关闭并重建整个连接池
+func (c *channelPool) closeExpired(wrapConn *idleConn) bool {
+	//判断是否超时，超时则丢弃
+	if timeout := c.idleTimeout; timeout > 0 && wrapConn.t.Add(timeout).Before(time.Now()) {
+		c.mu.Lock()
+		_, ok := c.opened[wrapConn.conn]
+		evict := ok && len(c.opened) > c.initialCap
+		if evict {
+			c.stats.IdleClosed++
+			c.forget(wrapConn.conn)
+		}
+		c.mu.Unlock()
+		if evict {
+			if c.close != nil {
+				c.close(wrapConn.conn)
+			}
+			return true
+		}
+	}
+	return c.closeOutlived(wrapConn.conn)
+}
+
+// closeOutlived 关闭超过存活时间的连接
+func (c *channelPool) closeOutlived(conn interface{}) bool {
+	if c.maxLifetime <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	created, ok := c.opened[conn]
+	outlived := ok && created.Add(c.maxLifetime).Before(time.Now())
+	if outlived {
+		c.stats.LifetimeClosed++
+	}
+	c.mu.Unlock()
+	if outlived {
+		c.Close(conn)
+	}
+	return outlived
+}
+
+// open 在已占用 slot 的情况下新建连接，失败时归还 slot
+func (c *channelPool) open() (interface{}, error) {
+	c.mu.Lock()
+	factory := c.factory
+	c.mu.Unlock()
+	if factory == nil {
+		<-c.slots
+		return nil, ErrClosed
+	}
+	conn, err := factory()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.stats.FactoryErrors++
+		<-c.slots
+		return nil, err
+	}
+	c.stats.Created++
+	c.opened[conn] = time.Now()
+	return conn, nil
+}
+
+// addWait 记录一次等待
+func (c *channelPool) addWait(start time.Time) {
+	c.mu.Lock()
+	c.stats.WaitCount++
+	c.stats.WaitDuration += time.Since(start)
+	c.mu.Unlock()
 }
 
-// Put 将连接放回pool中
+// Put 将连接放回pool中，连接池已关闭时直接关闭该连接
 func (c *channelPool) Put(conn interface{}) error {
 	if conn == nil {
 		return errors.New("connection is nil. rejecting")
 	}
 
-	c.mu.Lock()
-
-	if c.conns == nil {
-		c.mu.Unlock()
+	if c.closeOutlived(conn) {
+		return nil
+	}
+	if !c.putIdle(&idleConn{conn: conn, t: time.Now()}) {
+		//连接池已关闭或已满，直接关闭该连接
 		return c.Close(conn)
 	}
+	return nil
+}
 
+// putIdle 放入空闲连接，连接池已关闭或已满时返回 false
+func (c *channelPool) putIdle(wrapConn *idleConn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conns == nil {
+		return false
+	}
 	select {
-	case c.conns <- &idleConn{conn: conn, t: time.Now()}:
-		c.mu.Unlock()
-		return nil
+	case c.conns <- wrapConn:
+		return true
 	default:
-		c.mu.Unlock()
-		//连接池已满，直接关闭该连接
-		return c.Close(conn)
+		return false
 	}
 }
 
-// Close 关闭单条连接
+// Close 关闭单条连接，并让出该连接占用的 slot
 func (c *channelPool) Close(conn interface{}) error {
 	if conn == nil {
 		return errors.New("connection is nil. rejecting")
 	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.forget(conn)
+	c.mu.Unlock()
 	if c.close == nil {
 		return nil
 	}
 	return c.close(conn)
 }
 
-// Ping 检查单条连接是否有效
-func (c *channelPool) Ping(conn interface{}) error {
+// forget 移除连接记录并让出该连接占用的 slot，调用方需持有 mu
+func (c *channelPool) forget(conn interface{}) {
+	if _, ok := c.opened[conn]; ok {
+		delete(c.opened, conn)
+		<-c.slots
+	}
+}
+
+// Ping 检查单条连接是否有效，最多等待 HealthCheckInterval（未设置时为 DefaultPingTimeout）
+func (c *channelPool) Ping(ctx context.Context, conn interface{}) error {
 	if conn == nil {
 		return errors.New("connection is nil. rejecting")
 	}
-	return c.ping(conn)
+	timeout := c.healthCheckInterval
+	if timeout <= 0 {
+		timeout = DefaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return c.ping(ctx, conn)
 }
 
-// Release 释放连接池中所有连接
+// Release 停止后台维护并释放连接池中所有空闲连接，使用中的连接在 Put 时关闭
 func (c *channelPool) Release() {
 	c.mu.Lock()
 	conns := c.conns
 	c.conns = nil
 	c.factory = nil
-	c.ping = nil
-	closeFun := c.close
-	c.close = nil
 	c.mu.Unlock()
 
 	if conns == nil {
 		return
 	}
 
+	close(c.done)
+	c.wg.Wait()
 	close(conns)
 	for wrapConn := range conns {
-		closeFun(wrapConn.conn)
+		c.Close(wrapConn.conn)
 	}
 }
 
@@ -196,3 +376,26 @@ func (c *channelPool) Release() {
 func (c *channelPool) Len() int {
 	return len(c.getConns())
 }
+
+// Stats 连接池统计信息
+func (c *channelPool) Stats() PoolStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	if c.conns != nil {
+		stats.Idle = len(c.conns)
+	}
+	stats.InUse = len(c.opened) - stats.Idle
+	return stats
+}
+
+// Conns 所有已打开的连接，包括正在使用的
+func (c *channelPool) Conns() []interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	conns := make([]interface{}, 0, len(c.opened))
+	for conn := range c.opened {
+		conns = append(conns, conn)
+	}
+	return conns
+}
@@ -0,0 +1,263 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeConn struct {
+	id int
+}
+
+// fakePooler create fakeConn and count the created and closed connections.
+type fakePooler struct {
+	mu      sync.Mutex
+	created int
+	closed  int
+	ping    func(context.Context) error
+}
+
+func (p *fakePooler) Factory() (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.created++
+	return &fakeConn{id: p.created}, nil
+}
+
+func (p *fakePooler) Ping(ctx context.Context, v interface{}) error {
+	if p.ping != nil {
+		return p.ping(ctx)
+	}
+	return nil
+}
+
+func (p *fakePooler) Close(v interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed++
+	return nil
+}
+
+func (p *fakePooler) counts() (created, closed int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.created, p.closed
+}
+
+func newFakePool(t *testing.T, p *fakePooler, config Config) *channelPool {
+	config.Factory = p.Factory
+	config.Close = p.Close
+	config.Ping = p.Ping
+	pool, err := NewChannelPool(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Release)
+	return pool.(*channelPool)
+}
+
+func TestAcquireRelease(t *testing.T) {
+	if err := RegisterPoolWithConfig("test_acquire", new(fakePooler), true, Config{InitialCap: 1, MaxCap: 2}); err != nil {
+		t.Fatal(err)
+	}
+	defer ReleasePool("test_acquire")
+
+	l1, err := Acquire(context.Background(), "test_acquire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := Acquire(context.Background(), "test_acquire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l1.Client() == l2.Client() {
+		t.Fatal("two leases share a connection")
+	}
+	if stats, _ := Stats("test_acquire"); stats.InUse != 2 || stats.Idle != 0 {
+		t.Errorf("stats = %+v, want 2 in use and 0 idle", stats)
+	}
+
+	// released only once
+	l1.Release()
+	l1.Release()
+	if stats, _ := Stats("test_acquire"); stats.InUse != 1 || stats.Idle != 1 {
+		t.Errorf("stats after release = %+v, want 1 in use and 1 idle", stats)
+	}
+
+	l3, err := Acquire(context.Background(), "test_acquire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l3.Client() != l1.Client() {
+		t.Error("the released connection is not reused")
+	}
+	l2.Release()
+	l3.Release()
+
+	if _, err = Acquire(context.Background(), "test_unknown"); err != ErrGetConnection {
+		t.Errorf("Acquire() unknown pool err = %v, want %v", err, ErrGetConnection)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	p := newFakePool(t, new(fakePooler), Config{MaxCap: 1, WaitTimeout: 20 * time.Millisecond})
+
+	conn, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Get(context.Background()); err != ErrWaitTimeout {
+		t.Errorf("Get() err = %v, want %v", err, ErrWaitTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = p.Get(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Get() canceled err = %v, want %v", err, context.Canceled)
+	}
+	if stats := p.Stats(); stats.WaitCount != 2 {
+		t.Errorf("WaitCount = %d, want 2", stats.WaitCount)
+	}
+	p.Put(conn)
+}
+
+func TestWaitOrder(t *testing.T) {
+	p := newFakePool(t, new(fakePooler), Config{MaxCap: 1})
+
+	conn, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan string, 3)
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			conn, err := p.Get(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- name
+			p.Put(conn)
+		}(name)
+		// make sure the waiters are queued in order
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	p.Put(conn)
+	wg.Wait()
+	close(order)
+	got := ""
+	for name := range order {
+		got += name
+	}
+	if got != "abc" {
+		t.Errorf("waiters served in order %q, want %q", got, "abc")
+	}
+}
+
+func TestCloseSlot(t *testing.T) {
+	fake := new(fakePooler)
+	p := newFakePool(t, fake, Config{MaxCap: 1, WaitTimeout: 20 * time.Millisecond})
+
+	conn, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a connection not opened by the pool does not give back a slot
+	p.Close(&fakeConn{})
+	if _, err = p.Get(context.Background()); err != ErrWaitTimeout {
+		t.Errorf("Get() err = %v, want %v", err, ErrWaitTimeout)
+	}
+
+	// closing an opened connection gives back its slot once
+	p.Close(conn)
+	p.Close(conn)
+	if stats := p.Stats(); stats.InUse != 0 {
+		t.Errorf("InUse = %d, want 0", stats.InUse)
+	}
+	conn, err = p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created, _ := fake.counts(); created != 2 {
+		t.Errorf("created = %d, want 2", created)
+	}
+	if _, err = p.Get(context.Background()); err != ErrWaitTimeout {
+		t.Errorf("Get() at MaxCap err = %v, want %v", err, ErrWaitTimeout)
+	}
+	p.Put(conn)
+}
+
+func TestIdleKeepsInitialCap(t *testing.T) {
+	fake := new(fakePooler)
+	p := newFakePool(t, fake, Config{
+		InitialCap:       2,
+		MaxCap:           4,
+		IdleTimeout:      10 * time.Millisecond,
+		MaintainInterval: 10 * time.Millisecond,
+	})
+
+	conns := []interface{}{}
+	for i := 0; i < 4; i++ {
+		conn, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		p.Put(conn)
+	}
+
+	// several rounds of maintenance, only the connections above InitialCap are evicted
+	time.Sleep(100 * time.Millisecond)
+	if created, closed := fake.counts(); created != 4 || closed != 2 {
+		t.Errorf("created, closed = %d, %d, want 4, 2", created, closed)
+	}
+	if stats := p.Stats(); stats.Idle != 2 || stats.IdleClosed != 2 {
+		t.Errorf("stats = %+v, want 2 idle and 2 idle closed", stats)
+	}
+}
+
+func TestReleaseStopsPing(t *testing.T) {
+	pinging := make(chan struct{}, 1)
+	fake := &fakePooler{ping: func(ctx context.Context) error {
+		select {
+		case pinging <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	config := Config{
+		InitialCap:          1,
+		MaxCap:              1,
+		HealthCheckInterval: 10 * time.Millisecond,
+		Factory:             fake.Factory,
+		Close:               fake.Close,
+		Ping:                fake.Ping,
+	}
+	p, err := NewChannelPool(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-pinging
+
+	released := make(chan struct{})
+	go func() {
+		p.Release()
+		close(released)
+	}()
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("Release() blocked by the running ping")
+	}
+}
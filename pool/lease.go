@@ -0,0 +1,39 @@
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Lease 从连接池借出的连接，在 Release 之前只属于持有者
+type Lease struct {
+	pool Pool
+	conn interface{}
+	once sync.Once
+}
+
+// Acquire 从连接池借出一个连接，连接数达到上限时等待，直到有连接归还、ctx 结束或等待超时
+func Acquire(ctx context.Context, poolName string) (*Lease, error) {
+	p, ok := pools.get(poolName)
+	if !ok {
+		return nil, ErrGetConnection
+	}
+	conn, err := p.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{pool: p, conn: conn}, nil
+}
+
+// Client 借出的连接，*mongo.Client 或 *sql.DB
+func (l *Lease) Client() interface{} {
+	return l.conn
+}
+
+// Release 归还连接，多次调用只归还一次，连接池已释放时关闭该连接
+func (l *Lease) Release() (err error) {
+	l.once.Do(func() {
+		err = l.pool.Put(l.conn)
+	})
+	return
+}
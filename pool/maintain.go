@@ -0,0 +1,106 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// maintain 后台维护连接池，Release 时退出
+func (c *channelPool) maintain() {
+	defer c.wg.Done()
+
+	// Release 时结束正在进行的 ping，不等待其超时
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var maintain, health <-chan time.Time
+	if c.maintainInterval > 0 {
+		ticker := time.NewTicker(c.maintainInterval)
+		defer ticker.Stop()
+		maintain = ticker.C
+	}
+	if c.healthCheckInterval > 0 {
+		ticker := time.NewTicker(c.healthCheckInterval)
+		defer ticker.Stop()
+		health = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-maintain:
+			c.eachIdle(func(wrapConn *idleConn) bool {
+				return !c.closeExpired(wrapConn)
+			})
+			c.refill()
+		case <-health:
+			c.eachIdle(func(wrapConn *idleConn) bool {
+				return c.checkIdle(ctx, wrapConn)
+			})
+			c.refill()
+		}
+	}
+}
+
+// eachIdle 依次取出当前的空闲连接检查，check 返回 true 表示连接可用并放回连接池，
+// 每次只取出一条连接，不影响其他 Get
+func (c *channelPool) eachIdle(check func(*idleConn) bool) {
+	conns := c.getConns()
+	if conns == nil {
+		return
+	}
+	for i, n := 0, len(conns); i < n; i++ {
+		select {
+		case <-c.done:
+			return
+		case wrapConn := <-conns:
+			if wrapConn == nil {
+				return
+			}
+			if !check(wrapConn) {
+				continue
+			}
+			if !c.putIdle(wrapConn) {
+				c.Close(wrapConn.conn)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// refill 连接数不足 InitialCap 时新建连接
+func (c *channelPool) refill() {
+	for {
+		c.mu.Lock()
+		enough := len(c.opened) >= c.initialCap
+		c.mu.Unlock()
+		if enough {
+			return
+		}
+
+		select {
+		case <-c.done:
+			return
+		case c.slots <- struct{}{}:
+		default:
+			return
+		}
+		conn, err := c.open()
+		if err != nil {
+			return
+		}
+		if !c.putIdle(&idleConn{conn: conn, t: time.Now()}) {
+			c.Close(conn)
+			return
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"sync"
 )
@@ -13,11 +14,13 @@ var (
 	ErrReleasePool   = errors.New("release pool error")
 	ErrGetConnection = errors.New("get connection error")
 	ErrPutConnection = errors.New("put connection error")
+	//ErrWaitTimeout 连接数达到上限，等待空闲连接超时
+	ErrWaitTimeout = errors.New("wait for connection timeout")
 )
 
 // Pool 基本方法
 type Pool interface {
-	Get() (interface{}, error)
+	Get(context.Context) (interface{}, error)
 
 	Put(interface{}) error
 
@@ -26,6 +29,10 @@ type Pool interface {
 	Release()
 
 	Len() int
+
+	Stats() PoolStats
+
+	Conns() []interface{}
 }
 
 type _pools struct {
@@ -60,10 +67,10 @@ func (m *_pools) get(name string) (p Pool, ok bool) {
 	return
 }
 
-// get pool if cached.
+// delete pool if cached.
 func (m *_pools) del(name string) {
-	m.mux.RLock()
-	defer m.mux.RUnlock()
+	m.mux.Lock()
+	defer m.mux.Unlock()
 	delete(m.cache, name)
 	return
 }
@@ -12,8 +12,8 @@ type ClickConn struct {
 func (c *ClickConn) Factory() (v interface{}, err error) {
 	return sql.Open("clickhouse", c.Address)
 }
-func (c *ClickConn) Ping(v interface{}) (err error) {
-	return v.(*sql.DB).PingContext(context.Background())
+func (c *ClickConn) Ping(ctx context.Context, v interface{}) (err error) {
+	return v.(*sql.DB).PingContext(ctx)
 }
 func (c *ClickConn) Close(v interface{}) (err error) {
 	return v.(*sql.DB).Close()
@@ -22,3 +22,7 @@ func (c *ClickConn) Close(v interface{}) (err error) {
 func RegisterClickPool(poolName string, url string, force bool, params ...int) (err error) {
 	return RegisterPool(poolName, &ClickConn{Address: url}, force, params...)
 }
+
+func RegisterClickPoolWithConfig(poolName string, url string, force bool, config Config) (err error) {
+	return RegisterPoolWithConfig(poolName, &ClickConn{Address: url}, force, config)
+}
@@ -3,6 +3,7 @@ package pool
 import (
 	"context"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -10,13 +11,19 @@ import (
 
 type MgoConn struct {
 	Address string
+	// 可选，监听客户端执行的命令
+	Monitor *event.CommandMonitor
 }
 
 func (c *MgoConn) Factory() (v interface{}, err error) {
-	return mongo.Connect(context.Background(), options.Client().ApplyURI(c.Address))
+	opts := options.Client().ApplyURI(c.Address)
+	if c.Monitor != nil {
+		opts.SetMonitor(c.Monitor)
+	}
+	return mongo.Connect(context.Background(), opts)
 }
-func (c *MgoConn) Ping(v interface{}) (err error) {
-	return v.(*mongo.Client).Ping(context.Background(), readpref.Primary())
+func (c *MgoConn) Ping(ctx context.Context, v interface{}) (err error) {
+	return v.(*mongo.Client).Ping(ctx, readpref.Primary())
 }
 func (c *MgoConn) Close(v interface{}) (err error) {
 	return v.(*mongo.Client).Disconnect(context.Background())
@@ -25,3 +32,7 @@ func (c *MgoConn) Close(v interface{}) (err error) {
 func RegisterMgoPool(poolName string, url string, force bool, params ...int) (err error) {
 	return RegisterPool(poolName, &MgoConn{Address: url}, force, params...)
 }
+
+func RegisterMgoPoolWithConfig(poolName string, url string, force bool, config Config) (err error) {
+	return RegisterPoolWithConfig(poolName, &MgoConn{Address: url}, force, config)
+}
@@ -1,6 +1,8 @@
 package pool
 
 import (
+	"context"
+	"fmt"
 	"time"
 )
 
@@ -20,32 +22,47 @@ type DriverType int
 // 	}
 // )
 
+var (
+	//DefaultMaintainInterval RegisterPool 后台维护的间隔
+	DefaultMaintainInterval = 30 * time.Second
+	//DefaultHealthCheckInterval RegisterPool 后台 ping 空闲连接的间隔
+	DefaultHealthCheckInterval = time.Minute
+	//DefaultPingTimeout 未设置 HealthCheckInterval 时 ping 的超时时间
+	DefaultPingTimeout = 5 * time.Second
+)
+
+// RegisterError 注册连接池失败的具体原因，errors.Is(err, ErrRegisterPool) 为 true，
+// errors.As/Unwrap 可以取得工厂方法返回的错误
+type RegisterError struct {
+	Err error
+}
+
+func (e *RegisterError) Error() string {
+	return ErrRegisterPool.Error() + ": " + e.Err.Error()
+}
+
+func (e *RegisterError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RegisterError) Is(target error) bool {
+	return target == ErrRegisterPool
+}
+
 type Pooler interface {
 	Factory() (interface{}, error)
-	Ping(interface{}) error
+	Ping(context.Context, interface{}) error
 	Close(interface{}) error
 }
 
+// RegisterPool 注册连接池，params 依次为初始连接数、最大连接数、空闲时间（秒）、等待时间（秒），
+// 默认为（5，20，30，10），更多配置使用 RegisterPoolWithConfig
 func RegisterPool(poolName string, p Pooler, force bool, params ...int) (err error) {
-	//factory 创建连接的方法
-	factory := func() (interface{}, error) {
-		return p.Factory()
-	}
-
-	//close 关闭连接的方法
-	close := func(v interface{}) error {
-		return p.Close(v)
-	}
-
-	//ping 检测连接的方法
-	ping := func(v interface{}) error {
-		return p.Ping(v)
-	}
-
 	var (
 		size int           = 5
 		cap  int           = 20
 		idle time.Duration = 30
+		wait time.Duration = 10
 	)
 
 	for i, v := range params {
@@ -56,37 +73,54 @@ func RegisterPool(poolName string, p Pooler, force bool, params ...int) (err err
 			cap = v
 		case 2:
 			idle = time.Duration(v)
+		case 3:
+			wait = time.Duration(v)
 		}
 	}
 	//创建一个连接池： 初始化5，最大连接30
-	poolConfig := &Config{
+	poolConfig := Config{
 		InitialCap: size,
 		MaxCap:     cap,
-		Factory:    factory,
-		Close:      close,
-		Ping:       ping,
 		//连接最大空闲时间，超过该时间的连接 将会关闭，可避免空闲时连接EOF，自动失效的问题
 		IdleTimeout: idle * time.Second,
+		//连接数达到上限时等待空闲连接的时间
+		WaitTimeout: wait * time.Second,
+		//后台定期关闭失效的空闲连接并补足初始连接，避免网络中断后由请求逐个发现失效连接
+		MaintainInterval:    DefaultMaintainInterval,
+		HealthCheckInterval: DefaultHealthCheckInterval,
 	}
-	pool, err := NewChannelPool(poolConfig)
+	return RegisterPoolWithConfig(poolName, p, force, poolConfig)
+}
+
+// RegisterPoolWithConfig 使用 config 注册连接池，config 的 Factory、Close、Ping 为空时使用 p 的方法，
+// 失败时返回的错误包含 ErrRegisterPool 和具体原因
+func RegisterPoolWithConfig(poolName string, p Pooler, force bool, config Config) (err error) {
+	if config.Factory == nil {
+		config.Factory = p.Factory
+	}
+	if config.Close == nil {
+		config.Close = p.Close
+	}
+	if config.Ping == nil {
+		config.Ping = p.Ping
+	}
+
+	pool, err := NewChannelPool(&config)
 	if err != nil {
-		return ErrRegisterPool
+		return &RegisterError{Err: err}
 	}
 
 	if !pools.add(poolName, pool, force) {
-		return ErrRegisterPool
+		pool.Release()
+		return &RegisterError{Err: fmt.Errorf("pool name `%s` already registered", poolName)}
 	}
 	return
 }
 
+// GetClient 从连接池取出一个连接，使用完后必须调用 PutClient 归还，推荐使用 Acquire
 func GetClient(poolName string) (c interface{}, err error) {
 	if p, ok := pools.get(poolName); ok {
-		v, err := p.Get()
-		if err == nil {
-			c = v
-			defer PutClient(poolName, c)
-		}
-		return c, err
+		return p.Get(context.Background())
 	}
 	return nil, ErrGetConnection
 }
@@ -113,6 +147,22 @@ func IsRegister(poolName string) (ok bool) {
 	return
 }
 
+// Stats 连接池统计信息
+func Stats(poolName string) (stats PoolStats, ok bool) {
+	if p, ok := pools.get(poolName); ok {
+		return p.Stats(), true
+	}
+	return
+}
+
+// Conns 连接池中所有已打开的连接，仅用于统计，不能关闭或长期持有
+func Conns(poolName string) []interface{} {
+	if p, ok := pools.get(poolName); ok {
+		return p.Conns()
+	}
+	return nil
+}
+
 func ReleaseAll() {
 	for k, v := range pools.cache {
 		v.Release()
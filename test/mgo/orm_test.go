@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"testing"
 
 	"github.com/souliot/siot-orm/orm"
@@ -140,7 +141,7 @@ func TestQsIndexList(t *testing.T) {
 	o.Using("default")
 
 	qs := o.QueryTable("log")
-	indexes, err := qs.IndexView().List()
+	indexes, err := qs.IndexView().List(context.Background())
 	t.Log(indexes, err)
 }
 func TestQsIndexCreateOne(t *testing.T) {
@@ -152,7 +153,7 @@ func TestQsIndexCreateOne(t *testing.T) {
 	index.Keys = []string{"-username", "_id"}
 	index.SetName("username").SetUnique(true)
 
-	indexes, err := qs.IndexView().CreateOne(index)
+	indexes, err := qs.IndexView().CreateOne(context.Background(), index)
 	t.Log(indexes, err)
 
 }
@@ -161,6 +162,6 @@ func TestQsIndexDropOne(t *testing.T) {
 	o.Using("default")
 
 	qs := o.QueryTable("log")
-	err := qs.IndexView().DropOne("username")
+	err := qs.IndexView().DropOne(context.Background(), "username")
 	t.Log(err)
 }